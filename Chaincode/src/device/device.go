@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"encoding/json"
 	"regexp"
@@ -68,8 +69,8 @@ type Device struct {
 
 
 //==============================================================================================================================
-//	V5C Holder - Defines the structure that holds all the imeiList for vehicles that have been created.
-//				Used as an index when querying all vehicles.
+//	IMEI Holder - Defines the structure that held all the imeiList for devices that had been created. Devices are now
+//				  stored under the key device_<imeiId> and found with a range query, this is only read by migrate_index.
 //==============================================================================================================================
 
 type IMEI_Holder struct {
@@ -94,14 +95,6 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string
 	//				0
 	//			peer_address
 
-	var imeiList IMEI_Holder
-
-	bytes, err := json.Marshal(imeiList)
-
-    if err != nil { return nil, errors.New("Error creating IMEI_Holder record") }
-
-	err = stub.PutState("imeiList", bytes)
-
 	for i:=0; i < len(args); i=i+2 {
 		t.add_ecert(stub, args[i], args[i+1])
 	}
@@ -196,7 +189,7 @@ func (t *SimpleChaincode) retrieve_IMEI(stub shim.ChaincodeStubInterface, imeiId
 
 	var v Device
 
-	bytes, err := stub.GetState(imeiId);
+	bytes, err := stub.GetState("device_" + imeiId);
 
 	if err != nil {	fmt.Printf("RETRIEVE_IMEI: Failed to invoke imei_code: %s", err); return v, errors.New("RETRIEVE_IMEI: Error retrieving device with imeiId = " + imeiId) }
 
@@ -217,7 +210,7 @@ func (t *SimpleChaincode) save_changes(stub shim.ChaincodeStubInterface, v Devic
 
 	if err != nil { fmt.Printf("SAVE_CHANGES: Error converting device record: %s", err); return false, errors.New("Error converting device record") }
 
-	err = stub.PutState(v.IMEI, bytes)
+	err = stub.PutState("device_" + v.IMEI, bytes)
 
 	if err != nil { fmt.Printf("SAVE_CHANGES: Error storing device record: %s", err); return false, errors.New("Error storing device record") }
 
@@ -249,6 +242,8 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function stri
 
 	if function == "create_device" {
         return t.create_device(stub, caller, caller_affiliation, args[0])
+	} else if function == "migrate_index" {
+        return t.migrate_index(stub, caller, caller_affiliation)
 	} else if function == "ping" {
         return t.ping(stub)
     } else { 																				// If the function is not a create then there must be a car so we need to retrieve the car.
@@ -372,7 +367,7 @@ func (t *SimpleChaincode) create_device(stub shim.ChaincodeStubInterface, caller
 		return nil, errors.New("Invalid JSON object") 
 	}
 
-	record, err := stub.GetState(d.IMEI) 								// If not an error then a record exists so cant create a new car with this V5cID as it must be unique
+	record, err := stub.GetState("device_" + d.IMEI) 					// If not an error then a record exists so cant create a new car with this V5cID as it must be unique
 	if record != nil { return nil, errors.New("Device already exists") }
 
 	//if 	caller_affiliation != MANUFACTURER {							// Only the regulator can create a new imei
@@ -386,22 +381,54 @@ func (t *SimpleChaincode) create_device(stub shim.ChaincodeStubInterface, caller
 		return nil, errors.New("Error saving changes") 
 	}
 
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 Migration Functions
+//=================================================================================================================================
+//	 migrate_index - Moves the devices listed in an old IMEI_Holder record from the key imeiId to device_<imeiId> and
+//					 then deletes the IMEI_Holder. Only a manufacturer can migrate. Returns the number of devices moved.
+//=================================================================================================================================
+func (t *SimpleChaincode) migrate_index(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	if caller_affiliation != MANUFACTURER { return nil, errors.New(fmt.Sprintf("Permission Denied. migrate_index. %v === %v", caller_affiliation, MANUFACTURER)) }
+
 	bytes, err := stub.GetState("imeiList")
 	if err != nil { return nil, errors.New("Unable to get imeiList") }
+	if bytes == nil { return nil, errors.New("MIGRATE_INDEX: Nothing to migrate") }
 
 	var imeiList IMEI_Holder
 	err = json.Unmarshal(bytes, &imeiList)
 	if err != nil {	return nil, errors.New("Corrupt IMEI_Holder record") }
 
-	imeiList.IMEIs = append(imeiList.IMEIs, imeiId)
-	bytes, err = json.Marshal(imeiList)
-	if err != nil { fmt.Print("Error creating IMEI_Holder record") }
+	migrated := 0
 
-	err = stub.PutState("imeiList", bytes)
-	if err != nil { return nil, errors.New("Unable to put the state") }
+	for _, imeiId := range imeiList.IMEIs {
 
-	return nil, nil
+		record, err := stub.GetState(imeiId)
+		if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to get device " + imeiId) }
+
+		if record == nil { continue }						// Already moved
 
+		existing, err := stub.GetState("device_" + imeiId)
+		if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to get device " + imeiId) }
+		if existing != nil { return nil, errors.New("MIGRATE_INDEX: Device " + imeiId + " is stored under both keys") }
+
+		err = stub.PutState("device_" + imeiId, record)
+		if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to store device " + imeiId) }
+
+		err = stub.DelState(imeiId)
+		if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to remove device " + imeiId) }
+
+		migrated++
+	}
+
+	err = stub.DelState("imeiList")
+	if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to remove IMEI_Holder") }
+
+	return []byte(strconv.Itoa(migrated)), nil
 }
 
 //=================================================================================================================================
@@ -753,24 +780,24 @@ func (t *SimpleChaincode) get_device_details(stub shim.ChaincodeStubInterface, v
 //=================================================================================================================================
 
 func (t *SimpleChaincode) get_devices(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
-	bytes, err := stub.GetState("imeiList")
+	iter, err := stub.RangeQueryState("device_", "device_~")
 
-																			if err != nil { return nil, errors.New("Unable to get imeiList") }
+																			if err != nil { return nil, errors.New("Unable to get devices") }
+	defer iter.Close()
 
-	var imeiList IMEI_Holder
+	result := "["
 
-	err = json.Unmarshal(bytes, &imeiList)
+	var temp []byte
 
-																			if err != nil {	return nil, errors.New("Corrupt V5C_Holder") }
+	for iter.HasNext() {
 
-	result := "["
+		_, record, err := iter.Next()
 
-	var temp []byte
-	var v Device
+		if err != nil {return nil, errors.New("Failed to retrieve IMEI")}
 
-	for _, IMEI := range imeiList.IMEIs {
+		var v Device
 
-		v, err = t.retrieve_IMEI(stub, IMEI)
+		err = json.Unmarshal(record, &v)
 
 		if err != nil {return nil, errors.New("Failed to retrieve IMEI")}
 
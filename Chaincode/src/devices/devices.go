@@ -3,12 +3,14 @@ package devices
 import ( 
   "fmt" 
   "errors" 
+  "strconv"
   "github.com/hyperledger/fabric/core/chaincode/shim" 
   "encoding/json"
 )
 
 var logger = shim.NewLogger("DIChaincode")
 
+// Devices are stored under the key device_<imei>, IMEI_Holder is only read by migrate_index
 type IMEI_Holder struct { 
   IMEIs  []string `json:"imeis"`
 }
@@ -29,16 +31,14 @@ type SimpleChainCode struct {
 }
 
 func (t *SimpleChainCode) Init(stub shim.ChaincodeStubInterface, function string, args[] string) ([]byte, error ) {  
-  var imeiIds IMEI_Holder  
-  bytes, err := json.Marshal(imeiIds);
-  if err != nil { return nil, errors.New("Error creating IMEI_Holder record") }
-  err = stub.PutState("imeiIds", bytes)
-  return nil, err
+  return nil, nil
 } 
 
 func (t *SimpleChainCode) Invoke(stub shim.ChaincodeStubInterface, function string, args[] string) ([]byte, error) {  
   if function == "create_device" {  
     return t.createDevice(stub, args[0])
+  } else if function == "migrate_index" {
+    return t.migrate_index(stub)
   }  
   return nil, nil
 }
@@ -54,7 +54,6 @@ func (t *SimpleChainCode) Query(stub shim.ChaincodeStubInterface, function strin
 func (t *SimpleChainCode) createDevice(stub shim.ChaincodeStubInterface, imeiId string) ([]byte, error) { 
   var d Device
   var err error
-  var IMEI_Ids IMEI_Holder
   DeviceName  := "\"deviceName\":\"LENOVO\", "
   DeviceModel := "\"devicemodel\":\"VIBE\", "
   DateOfManf  := "\"dateofmanf\":\"''03-12-2016''\" , "
@@ -70,34 +69,53 @@ func (t *SimpleChainCode) createDevice(stub shim.ChaincodeStubInterface, imeiId
   }  
   
   err = json.Unmarshal([]byte(json_device), &d)  
-  record, err := stub.GetState(d.IMEI)
+  record, err := stub.GetState("device_" + d.IMEI)
   if record != nil { return nil, errors.New("Device already exists") }
   _, err = t.save_changes(stub, d)
   if err != nil { fmt.Printf("CREATEDEVICE: Error saving changes: %s", err); return nil, errors.New("Error saving changes") } 
-  bytes, err := stub.GetState("imeiIds")
-  if err != nil { return nil, errors.New("Unable to get imeiIds") } 
-  err = json.Unmarshal(bytes, &IMEI_Ids)
-  if err != nil { return nil, errors.New("Corrupt IMEI_Holder record") }
-  IMEI_Ids.IMEIs = append(IMEI_Ids.IMEIs, imeiId)
-  bytes, err = json.Marshal(IMEI_Ids)
-  if err != nil { fmt.Printf("Error creating IMEI_Holder record") }
-  err = stub.PutState("imeiIds", bytes)
-  if err != nil { return nil, errors.New("Unable to put the state") } 
   return nil, nil
 
 }
 
+// Moves the devices listed in an old IMEI_Holder record from the key imei to device_<imei> and then deletes the
+// IMEI_Holder. Returns the number of devices moved.
+func (t *SimpleChainCode) migrate_index(stub shim.ChaincodeStubInterface) ([]byte, error) {
+  bytes, err := stub.GetState("imeiIds")
+  if err != nil { return nil, errors.New("Unable to get imeiIds") }
+  if bytes == nil { return nil, errors.New("MIGRATE_INDEX: Nothing to migrate") }
+  var imeiIds IMEI_Holder
+  err = json.Unmarshal(bytes, &imeiIds)
+  if err != nil { return nil, errors.New("Corrupt IMEI_Holder record") }
+  migrated := 0
+  for _, imeiId := range imeiIds.IMEIs {
+    record, err := stub.GetState(imeiId)
+    if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to get device " + imeiId) }
+    if record == nil { continue }                         // Already moved
+    existing, err := stub.GetState("device_" + imeiId)
+    if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to get device " + imeiId) }
+    if existing != nil { return nil, errors.New("MIGRATE_INDEX: Device " + imeiId + " is stored under both keys") }
+    err = stub.PutState("device_" + imeiId, record)
+    if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to store device " + imeiId) }
+    err = stub.DelState(imeiId)
+    if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to remove device " + imeiId) }
+    migrated++
+  }
+  err = stub.DelState("imeiIds")
+  if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to remove IMEI_Holder") }
+  return []byte(strconv.Itoa(migrated)), nil
+}
+
 func (t *SimpleChainCode) save_changes(stub shim.ChaincodeStubInterface, d Device) (bool, error) {
   bytes, err := json.Marshal(d)
   if err != nil { fmt.Printf("SAVE_CHANGES: Error converting Device record: %s", err); return false, errors.New("Error converting Device record") } 
-  err = stub.PutState(d.IMEI, bytes)
+  err = stub.PutState("device_" + d.IMEI, bytes)
   if err != nil { fmt.Printf("SAVE_CHANGES: Error storing device record: %s", err); return false, errors.New("Error storing device record") }
   return true, nil
 }
 
 func (t *SimpleChainCode) get_device(stub shim.ChaincodeStubInterface, imeiId string) (Device, error) { 
   var dev Device
-  bytes, err := stub.GetState(imeiId)
+  bytes, err := stub.GetState("device_" + imeiId)
   if err != nil { fmt.Printf("error while retrieving device"); return dev, errors.New("error retrieving device") } 
   err = json.Unmarshal(bytes, &dev)
   if err != nil {fmt.Printf("failed to convert device data"); return dev, errors.New("error unmarshalling data") }
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"encoding/json"
 	"regexp"
+	"time"
 )
 
 var logger = shim.NewLogger("CLDChaincode")
@@ -22,22 +27,162 @@ const   MANUFACTURER   =  "manufacturer"
 const   PRIVATE_ENTITY =  "private"
 const   LEASE_COMPANY  =  "lease_company"
 const   SCRAP_MERCHANT =  "scrap_merchant"
+const   POLICE         =  "police"
+const   INSPECTOR      =  "inspector"
+const   LENDER         =  "lender"
+const   INSURER        =  "insurer"
+
+//==============================================================================================================================
+//	 Participant kinds - The registry type of a private participant that trades vehicles as a business
+//==============================================================================================================================
+const   DEALERSHIP     =  "dealership"
+
+
+//==============================================================================================================================
+//	 Participant status types - Only active participants in the participant registry can receive vehicles
+//==============================================================================================================================
+const   PARTICIPANT_ACTIVE 			=  "active"
+const   PARTICIPANT_SUSPENDED 		=  "suspended"
 
 
 //==============================================================================================================================
-//	 Status types - Asset lifecycle is broken down into 5 statuses, this is part of the business logic to determine what can
-//					be done to the vehicle at points in it's lifecycle
+//	 Status types - Asset lifecycle is broken down into 6 statuses, this is part of the business logic to determine what can
+//					be done to the vehicle at points in it's lifecycle. STATE_LEASE_OWNERSHIP was added after the others,
+//					it is the status of a vehicle owned by a lease company that isn't leased out.
 //==============================================================================================================================
 const   STATE_TEMPLATE  			=  0
 const   STATE_MANUFACTURE  			=  1
 const   STATE_PRIVATE_OWNERSHIP 	=  2
 const   STATE_LEASED_OUT 			=  3
 const   STATE_BEING_SCRAPPED  		=  4
+const   STATE_LEASE_OWNERSHIP 		=  5
+
+//==============================================================================================================================
+//	 Lease status types - A lease contract is created pending, becomes active when the lessee accepts it and the vehicle is
+//						  leased out, and finishes terminated, expired or returned
+//==============================================================================================================================
+const   LEASE_PENDING 				=  "pending"
+const   LEASE_ACTIVE 				=  "active"
+const   LEASE_TERMINATED 			=  "terminated"
+const   LEASE_EXPIRED 				=  "expired"
+const   LEASE_RETURNED 				=  "returned"
+
+//==============================================================================================================================
+//	 Enforcement actions - The regulator can freeze a vehicle, stopping any transfer or update, or seize it, taking
+//						   ownership of it as well
+//==============================================================================================================================
+const   ENFORCEMENT_FREEZE			=  "freeze"
+const   ENFORCEMENT_SEIZE			=  "seize"
+
+//==============================================================================================================================
+//	 Events - Every change to a vehicle emits a chaincode event. The event name is the type of the change, subscribers can
+//			  filter on it. When a transaction changes vehicles in more than one way the name is EVENT_VEHICLES_CHANGED
+//			  and each change carries its own type. The payload is a Vehicle_Event in JSON:
+//
+//				{ "version": EVENT_VERSION, "type": <event name>, "txID": <transaction ID>,
+//				  "changes": [ { "type", "v5cID", "function", "previousOwner", "newOwner", "previousStatus", "newStatus",
+//								 "changedFields": [ <JSON names of the vehicle fields that changed> ] } ] }
+//
+//			  EVENT_VERSION is increased whenever the payload changes in a way that isn't backwards compatible.
+//==============================================================================================================================
+const   EVENT_VERSION				=  1
+const   EVENT_VEHICLE_CREATED		=  "vehicle_created"
+const   EVENT_VEHICLE_TRANSFERRED	=  "vehicle_transferred"
+const   EVENT_VEHICLE_STATUS_CHANGED	=  "vehicle_status_changed"
+const   EVENT_VEHICLE_UPDATED		=  "vehicle_updated"
+const   EVENT_VEHICLE_SCRAPPED		=  "vehicle_scrapped"
+const   EVENT_VEHICLE_FROZEN		=  "vehicle_frozen"
+const   EVENT_VEHICLE_UNFROZEN		=  "vehicle_unfrozen"
+const   EVENT_VEHICLE_SEIZED		=  "vehicle_seized"
+const   EVENT_VEHICLE_STOLEN		=  "vehicle_stolen"
+const   EVENT_VEHICLE_RECOVERED		=  "vehicle_recovered"
+const   EVENT_VEHICLE_RECALLED		=  "vehicle_recalled"
+const   EVENT_VEHICLE_WRITTEN_OFF	=  "vehicle_written_off"
+const   EVENT_VEHICLES_CHANGED		=  "vehicles_changed"
+
+//==============================================================================================================================
+//	 Paging - Queries that can return a large number of records return them a page at a time. A page holds at most
+//			  MAX_PAGE_SIZE records, DEFAULT_PAGE_SIZE if the caller doesn't ask for a size.
+//==============================================================================================================================
+const   DEFAULT_PAGE_SIZE			=  50
+const   MAX_PAGE_SIZE				=  500
+
+//==============================================================================================================================
+//	 Inspection results - The result of a roadworthiness inspection. Only a pass that hasn't expired makes a vehicle
+//						  roadworthy.
+//==============================================================================================================================
+const   INSPECTION_PASS				=  "pass"
+const   INSPECTION_FAIL				=  "fail"
+
+const   SECONDS_PER_YEAR			=  365 * 24 * 60 * 60
+
+//==============================================================================================================================
+//	 Recall status types - A vehicle's part in a recall is open until a dealership carries out the remedy
+//==============================================================================================================================
+const   RECALL_OPEN					=  "open"
+const   RECALL_REMEDIED				=  "remedied"
+
+//==============================================================================================================================
+//	 Lien status types - A vehicle can't be transferred while a lien on it is active
+//==============================================================================================================================
+const   LIEN_ACTIVE					=  "active"
+const   LIEN_RELEASED				=  "released"
+
+//==============================================================================================================================
+//	 Write-off categories - The insurer's category for a written off vehicle, most severe first. A vehicle in category A or B
+//							can only go to a scrap merchant, S and N can be repaired and go back on the road. A
+//							category can't be removed or made less severe.
+//==============================================================================================================================
+const   WRITE_OFF_A					=  "A"
+const   WRITE_OFF_B					=  "B"
+const   WRITE_OFF_S					=  "S"
+const   WRITE_OFF_N					=  "N"
+
+var write_off_categories = []string{WRITE_OFF_A, WRITE_OFF_B, WRITE_OFF_S, WRITE_OFF_N}
+
+//==============================================================================================================================
+//	 Logbook status types - The answer verify_logbook gives for a presented logbook. A superseded logbook was issued for the
+//							vehicle but replaced by a later transfer, an unknown one was never issued for it.
+//==============================================================================================================================
+const   LOGBOOK_CURRENT				=  "current"
+const   LOGBOOK_SUPERSEDED			=  "superseded"
+const   LOGBOOK_UNKNOWN				=  "unknown"
+
+//==============================================================================================================================
+//	 Plate status types - A registration plate is either on a vehicle or held on a retention certificate, which lasts
+//						  RETENTION_YEARS
+//==============================================================================================================================
+const   PLATE_ASSIGNED				=  "assigned"
+const   PLATE_RETAINED				=  "retained"
+
+const   RETENTION_YEARS				=  10
+
+//==============================================================================================================================
+//	 Tax status types - A vehicle is taxed until a date, declared off the road (SORN) or untaxed. A vehicle whose tax has
+//						run out is untaxed.
+//==============================================================================================================================
+const   TAX_TAXED					=  "taxed"
+const   TAX_SORN					=  "sorn"
+const   TAX_UNTAXED					=  "untaxed"
+
+const   MAX_TAX_MONTHS				=  12
+
+//==============================================================================================================================
+//	 Type approval status types - A make and model can only be given to vehicles while its approval is in force
+//==============================================================================================================================
+const   APPROVAL_APPROVED			=  "approved"
+const   APPROVAL_WITHDRAWN			=  "withdrawn"
+
+//==============================================================================================================================
+//	 Registration formats - The UK registration formats a plate must match, without spaces: current (AB12CDE), prefix
+//							(A123BCD), suffix (ABC123D) and dateless (ABC1234 or 1234ABC)
+//==============================================================================================================================
+var registration_formats = regexp.MustCompile("^([A-Z]{2}[0-9]{2}[A-Z]{3}|[A-Z][0-9]{1,3}[A-Z]{3}|[A-Z]{3}[0-9]{1,3}[A-Z]|[A-Z]{1,3}[0-9]{1,4}|[0-9]{1,4}[A-Z]{1,3})$")
 
 //==============================================================================================================================
 //	 Structure Definitions
 //==============================================================================================================================
-//	Chaincode - A blank struct for use with Shim (A HyperLedger included go file used for get/put state
+//	Chaincode - A struct for use with Shim (A HyperLedger included go file used for get/put state
 //				and other HyperLedger functions)
 //==============================================================================================================================
 type  SimpleChaincode struct {
@@ -45,31 +190,534 @@ type  SimpleChaincode struct {
 
 //==============================================================================================================================
 //	Vehicle - Defines the structure for a car object. JSON on right tells it what JSON fields to map to
-//			  that element when reading a JSON object into the struct e.g. JSON make -> Struct Make.
+//			  that element when reading a JSON object into the struct e.g. JSON make -> Struct Make. The Keeper is
+//			  the registered keeper who drives the vehicle when it isn't the Owner, e.g. the lessee of a leased car.
 //==============================================================================================================================
 type Vehicle struct {
 	Make            string `json:"make"`
 	Model           string `json:"model"`
 	Reg             string `json:"reg"`
-	VIN             int    `json:"VIN"`
+	VIN             string `json:"VIN"`
+	WMI             string `json:"wmi"`
 	Owner           string `json:"owner"`
 	Scrapped        bool   `json:"scrapped"`
 	Status          int    `json:"status"`
 	Colour          string `json:"colour"`
 	V5cID           string `json:"v5cID"`
 	LeaseContractID string `json:"leaseContractID"`
+	Frozen          bool         `json:"frozen"`
+	Enforcement     *Enforcement `json:"enforcement,omitempty"`
+	Stolen          *Theft_Report `json:"stolen,omitempty"`
+	Mileage         int          `json:"mileage"`
+	MileageDiscrepancy bool      `json:"mileageDiscrepancy"`
+	Inspection      *Inspection  `json:"inspection,omitempty"`
+	Recalls         []Vehicle_Recall `json:"recalls,omitempty"`
+	Financed        bool         `json:"financed"`
+	WriteOff        string       `json:"writeOff,omitempty"`
+	Keeper          string       `json:"keeper,omitempty"`
+	Logbook         *Logbook     `json:"logbook,omitempty"`
+	TaxStatus       string       `json:"taxStatus,omitempty"`
+	TaxedUntil      int64        `json:"taxedUntil,omitempty"`
+}
+
+//==============================================================================================================================
+//	Theft_Report - The report of a vehicle as stolen. A vehicle with a theft report can't be transferred until the police
+//				   mark it recovered.
+//==============================================================================================================================
+type Theft_Report struct {
+	CrimeRef        string `json:"crimeRef"`
+	ReportedBy      string `json:"reportedBy"`
+	Date            int64  `json:"date"`
+}
+
+//==============================================================================================================================
+//	Stolen_Check - The answer to check_stolen. Only says whether the vehicle is stolen and when it was reported.
+//==============================================================================================================================
+type Stolen_Check struct {
+	V5cID           string `json:"v5cID"`
+	Stolen          bool   `json:"stolen"`
+	Reported        int64  `json:"reported,omitempty"`
+}
+
+//==============================================================================================================================
+//	Enforcement - The regulator's action against a frozen vehicle. Action is freeze or seize, a seized vehicle is owned by
+//				  the regulator until it's released and PreviousOwner holds the owner it's released to.
+//==============================================================================================================================
+type Enforcement struct {
+	Action          string `json:"action"`
+	ReasonCode      string `json:"reasonCode"`
+	CaseRef         string `json:"caseRef"`
+	Officer         string `json:"officer"`
+	Date            int64  `json:"date"`
+	PreviousOwner   string `json:"previousOwner,omitempty"`
+}
+
+//==============================================================================================================================
+//	Legacy_Vehicle - A vehicle record written before VINs were strings, when the VIN was a 15 digit integer. The outer VIN
+//					 field hides the string VIN of the embedded Vehicle when the record is read.
+//==============================================================================================================================
+type Legacy_Vehicle struct {
+	Vehicle
+	VIN             int    `json:"VIN"`
 }
 
 
 //==============================================================================================================================
-//	V5C Holder - Defines the structure that holds all the v5cIDs for vehicles that have been created.
-//				Used as an index when querying all vehicles.
+//	V5C Holder - Defines the structure that held all the v5cIDs for vehicles that had been created. Vehicles are now stored
+//				under the key vehicle_<v5cID> and found with a range query, this is only read by migrate_index.
 //==============================================================================================================================
 
 type V5C_Holder struct {
 	V5Cs 	[]string `json:"v5cs"`
 }
 
+//==============================================================================================================================
+//	Participant - Defines the structure for an entry in the participant registry, stored under the key
+//				  participant_<identity>. The role is the role the participant is allowed to receive vehicles as, the type
+//				  is the kind of business shown in the client (e.g. a dealership and a leasee both have the private role).
+//==============================================================================================================================
+
+type Participant struct {
+	Identity        string   `json:"identity"`
+	Role            string   `json:"role"`
+	Type            string   `json:"type"`
+	Name            string   `json:"name"`
+	Address         []string `json:"address"`
+	Postcode        string   `json:"postcode"`
+	EnrolmentID     string   `json:"enrolmentID"`
+	Status          string   `json:"status"`
+	WMIs            []string `json:"wmis,omitempty"`
+}
+
+//==============================================================================================================================
+//	Transition - Defines a transfer of a vehicle allowed by the lifecycle. A vehicle in FromStatus owned by a CallerRole
+//				 participant may be transferred by function to a RecipientRole participant, moving it into ToStatus.
+//				 Requires lists the fields that must have been defined before the transfer is allowed.
+//==============================================================================================================================
+
+type Transition struct {
+	Function        string   `json:"function"`
+	FromStatus      int      `json:"fromStatus"`
+	CallerRole      string   `json:"callerRole"`
+	RecipientRole   string   `json:"recipientRole"`
+	ToStatus        int      `json:"toStatus"`
+	Requires        []string `json:"requires"`
+}
+
+//==============================================================================================================================
+//	Lifecycle - The transfers allowed between statuses, returned by get_lifecycle so that the client can show which
+//				transfers are allowed.
+//==============================================================================================================================
+
+type Lifecycle struct {
+	States          []string     `json:"states"`
+	Transitions     []Transition `json:"transitions"`
+}
+
+//==============================================================================================================================
+//	 Lifecycle table - Every transfer of a vehicle must match one of these transitions. A vehicle sold to a lease company
+//					   is in STATE_LEASE_OWNERSHIP until the lease company sells it on. While a lease contract is active
+//					   it is STATE_LEASED_OUT (see activate_lease) and it goes back to STATE_LEASE_OWNERSHIP when the lease
+//					   ends. No transfer starts from STATE_LEASED_OUT so a leased out vehicle can't be sold until its lease
+//					   has ended.
+//==============================================================================================================================
+var lifecycle = []Transition{
+	{"authority_to_manufacturer",  STATE_TEMPLATE,           AUTHORITY,       MANUFACTURER,    STATE_MANUFACTURE,        []string{}},
+	{"manufacturer_to_private",    STATE_MANUFACTURE,        MANUFACTURER,    PRIVATE_ENTITY,  STATE_PRIVATE_OWNERSHIP,  []string{"make", "model", "reg", "colour", "VIN"}},
+	{"private_to_private",         STATE_PRIVATE_OWNERSHIP,  PRIVATE_ENTITY,  PRIVATE_ENTITY,  STATE_PRIVATE_OWNERSHIP,  []string{}},
+	{"private_to_lease_company",   STATE_PRIVATE_OWNERSHIP,  PRIVATE_ENTITY,  LEASE_COMPANY,   STATE_LEASE_OWNERSHIP,    []string{}},
+	{"lease_company_to_private",   STATE_LEASE_OWNERSHIP,    LEASE_COMPANY,   PRIVATE_ENTITY,  STATE_PRIVATE_OWNERSHIP,  []string{}},
+	{"private_to_scrap_merchant",  STATE_PRIVATE_OWNERSHIP,  PRIVATE_ENTITY,  SCRAP_MERCHANT,  STATE_BEING_SCRAPPED,     []string{}},
+}
+
+//==============================================================================================================================
+//	 State names - The names of the statuses, indexed by status, returned with the lifecycle table
+//==============================================================================================================================
+var state_names = []string{"template", "manufacture", "private_ownership", "leased_out", "being_scrapped", "lease_ownership"}
+
+//==============================================================================================================================
+//	 History functions - The functions whose changes are kept in the vehicle's history even when they don't change its
+//						 owner or status, see keeps_history
+//==============================================================================================================================
+var history_functions = []string{"create_vehicle", "update_make", "update_model", "update_reg", "update_vin", "update_colour", "update_vehicle", "retain_plate", "transfer_plate", "scrap_vehicle"}
+
+//==============================================================================================================================
+//	 Vehicle fields - The fields update_vehicle can change, named as in the vehicle's JSON and in the order they are applied
+//==============================================================================================================================
+var vehicle_fields = []string{"VIN", "make", "model", "reg", "colour"}
+
+//==============================================================================================================================
+//	Transfer_Offer - Defines the structure for an offer to transfer a vehicle, stored under the key offer_<v5cID>. The
+//					 transfer only takes place when the recipient accepts the offer. An Expiry of 0 means the offer
+//					 doesn't expire, otherwise it is void once the transaction time passes Expiry. Offers made together
+//					 by transfer_vehicles share a BatchID and Batch lists all their v5cIDs, they are accepted, rejected
+//					 and cancelled together.
+//==============================================================================================================================
+
+type Transfer_Offer struct {
+	V5cID           string   `json:"v5cID"`
+	From            string   `json:"from"`
+	FromRole        string   `json:"fromRole"`
+	Recipient       string   `json:"recipient"`
+	TransferType    string   `json:"transferType"`
+	Created         int64    `json:"created"`
+	Expiry          int64    `json:"expiry"`
+	BatchID         string   `json:"batchID,omitempty"`
+	Batch           []string `json:"batch,omitempty"`
+}
+
+//==============================================================================================================================
+//	Transfer_Result - The outcome for one vehicle of a transfer, an offer or a transfer_vehicles call.
+//==============================================================================================================================
+
+type Transfer_Result struct {
+	V5cID           string `json:"v5cID"`
+	Result          string `json:"result"`
+	Error           string `json:"error,omitempty"`
+	OpenRecalls     []Vehicle_Recall `json:"openRecalls,omitempty"`
+}
+
+//==============================================================================================================================
+//	Lease_Contract - Defines the structure for a lease of a vehicle from the lease company that owns it (the lessor) to a
+//					 lessee. Stored under the key lease_<leaseID>. Dates are seconds since the epoch.
+//==============================================================================================================================
+
+type Lease_Contract struct {
+	LeaseID          string `json:"leaseID"`
+	V5cID            string `json:"v5cID"`
+	Lessor           string `json:"lessor"`
+	Lessee           string `json:"lessee"`
+	StartDate        int64  `json:"startDate"`
+	EndDate          int64  `json:"endDate"`
+	MonthlyPayment   int    `json:"monthlyPayment"`
+	MileageAllowance int    `json:"mileageAllowance"`
+	PaymentsMade     int    `json:"paymentsMade"`
+	AmountPaid       int    `json:"amountPaid"`
+	ReturnMileage    int    `json:"returnMileage"`
+	Status           string `json:"status"`
+}
+
+//==============================================================================================================================
+//	History_Entry - Defines the structure for a single change to a vehicle. Entries are stored under the key
+//					history_<v5cID>_<sequence> so that the history of a vehicle can be read back in order with a range query.
+//==============================================================================================================================
+
+type History_Entry struct {
+	V5cID           string `json:"v5cID"`
+	Sequence        int    `json:"sequence"`
+	Function        string `json:"function"`
+	Caller          string `json:"caller"`
+	PreviousOwner   string `json:"previousOwner"`
+	NewOwner        string `json:"newOwner"`
+	PreviousStatus  int    `json:"previousStatus"`
+	NewStatus       int    `json:"newStatus"`
+	TxID            string `json:"txID"`
+	Timestamp       int64  `json:"timestamp"`
+}
+
+//==============================================================================================================================
+//	History_Count - Holds the number of history entries written for a vehicle, stored under the key history_<v5cID>. Also
+//					used for the number of odometer readings, stored under odometer_<v5cID>.
+//==============================================================================================================================
+
+type History_Count struct {
+	Count 	int `json:"count"`
+}
+
+//==============================================================================================================================
+//	Odometer_Reading - A reading of a vehicle's odometer, stored under odometer_<v5cID>_<sequence>. A reading the regulator
+//					   marks as erroneous no longer counts as the vehicle's mileage, and the vehicle is flagged as having a
+//					   mileage discrepancy.
+//==============================================================================================================================
+
+type Odometer_Reading struct {
+	V5cID           string `json:"v5cID"`
+	Sequence        int    `json:"sequence"`
+	Miles           int    `json:"miles"`
+	Source          string `json:"source"`
+	RecordedBy      string `json:"recordedBy"`
+	Date            int64  `json:"date"`
+	Erroneous       bool   `json:"erroneous"`
+}
+
+//==============================================================================================================================
+//	Odometer_History - A page of odometer readings returned by get_odometer_history, oldest first.
+//==============================================================================================================================
+
+type Odometer_History struct {
+	V5cID              string             `json:"v5cID"`
+	MileageDiscrepancy bool               `json:"mileageDiscrepancy"`
+	Readings           []Odometer_Reading `json:"readings"`
+	Next               string             `json:"next"`
+}
+
+//==============================================================================================================================
+//	Inspection - A roadworthiness inspection of a vehicle, stored under inspection_<v5cID>_<sequence>, the number of
+//				 inspections is stored under inspection_<v5cID>. The latest inspection is also kept on the vehicle. Expiry
+//				 is the date the inspection stops being valid, Miles is 0 if the inspector didn't record the odometer.
+//==============================================================================================================================
+
+type Inspection struct {
+	V5cID           string   `json:"v5cID"`
+	Sequence        int      `json:"sequence"`
+	Result          string   `json:"result"`
+	Expiry          int64    `json:"expiry"`
+	Advisories      []string `json:"advisories"`
+	Failures        []string `json:"failures"`
+	Miles           int      `json:"miles,omitempty"`
+	Inspector       string   `json:"inspector"`
+	Date            int64    `json:"date"`
+}
+
+//==============================================================================================================================
+//	Inspection_Policy - The regulator's rule for transfers into private ownership, stored under inspection_policy. A vehicle
+//						at least MinimumAge years old needs a valid inspection to be transferred, 0 turns the rule off.
+//==============================================================================================================================
+
+type Inspection_Policy struct {
+	MinimumAge      int    `json:"minimumAge"`
+}
+
+//==============================================================================================================================
+//	Inspection_History - A page of inspections returned by get_inspections, oldest first.
+//==============================================================================================================================
+
+type Inspection_History struct {
+	V5cID           string       `json:"v5cID"`
+	Inspections     []Inspection `json:"inspections"`
+	Next            string       `json:"next"`
+}
+
+//==============================================================================================================================
+//	Recall - A safety recall issued by a manufacturer, stored under recall_<recallID>. The recall covers the vehicles of
+//			 the make and model with a VIN between VINFrom and VINTo, or in VINs, that carry one of the manufacturer's
+//			 WMIs. Vehicles lists the v5cIDs of the vehicles found when it was issued.
+//==============================================================================================================================
+
+type Recall struct {
+	RecallID        string   `json:"recallID"`
+	Manufacturer    string   `json:"manufacturer"`
+	Make            string   `json:"make"`
+	Model           string   `json:"model"`
+	Description     string   `json:"description"`
+	VINFrom         string   `json:"vinFrom,omitempty"`
+	VINTo           string   `json:"vinTo,omitempty"`
+	VINs            []string `json:"vins,omitempty"`
+	Issued          int64    `json:"issued"`
+	Vehicles        []string `json:"vehicles"`
+}
+
+//==============================================================================================================================
+//	Vehicle_Recall - A vehicle's part in a recall, kept on the vehicle. Remedied and RemediedBy are set when a dealership
+//					 carries out the remedy.
+//==============================================================================================================================
+
+type Vehicle_Recall struct {
+	RecallID        string `json:"recallID"`
+	Description     string `json:"description"`
+	Status          string `json:"status"`
+	Issued          int64  `json:"issued"`
+	Remedied        int64  `json:"remedied,omitempty"`
+	RemediedBy      string `json:"remediedBy,omitempty"`
+}
+
+//==============================================================================================================================
+//	Open_Recalls - The answer to get_open_recalls.
+//==============================================================================================================================
+
+type Open_Recalls struct {
+	V5cID           string           `json:"v5cID"`
+	Recalls         []Vehicle_Recall `json:"recalls"`
+}
+
+//==============================================================================================================================
+//	Lien - A lender's financial interest in a vehicle it doesn't own, stored under lien_<v5cID>_<lienID>. Amount is in
+//		   pence and is only shown to the parties: the lender, the owner and the regulator.
+//==============================================================================================================================
+
+type Lien struct {
+	LienID          string `json:"lienID"`
+	V5cID           string `json:"v5cID"`
+	Lender          string `json:"lender"`
+	Amount          int    `json:"amount,omitempty"`
+	Status          string `json:"status"`
+	Registered      int64  `json:"registered"`
+	Released        int64  `json:"released,omitempty"`
+}
+
+//==============================================================================================================================
+//	Finance_Check - The answer to check_finance, the active liens on a vehicle.
+//==============================================================================================================================
+
+type Finance_Check struct {
+	V5cID           string `json:"v5cID"`
+	Financed        bool   `json:"financed"`
+	Liens           []Lien `json:"liens"`
+}
+
+//==============================================================================================================================
+//	Damage_Event - Damage to a vehicle recorded by an insurer, stored under damage_<v5cID>_<sequence>, the number of events
+//				   is stored under damage_<v5cID>. Category is the write-off category the insurer assigned with it, if any.
+//==============================================================================================================================
+
+type Damage_Event struct {
+	V5cID           string `json:"v5cID"`
+	Sequence        int    `json:"sequence"`
+	Description     string `json:"description"`
+	Category        string `json:"category,omitempty"`
+	Insurer         string `json:"insurer"`
+	Date            int64  `json:"date"`
+}
+
+//==============================================================================================================================
+//	Damage_History - A page of damage events returned by get_damage_history, oldest first.
+//==============================================================================================================================
+
+type Damage_History struct {
+	V5cID           string         `json:"v5cID"`
+	WriteOff        string         `json:"writeOff,omitempty"`
+	Events          []Damage_Event `json:"events"`
+	Next            string         `json:"next"`
+}
+
+//==============================================================================================================================
+//	Logbook - The V5C document issued to the owner, a new one with a new DocumentRef is issued on every transfer. Each
+//			  logbook issued is also stored under logbook_<v5cID>_<documentRef> so that a superseded logbook can be told
+//			  apart from a forged one.
+//==============================================================================================================================
+
+type Logbook struct {
+	DocumentRef     string `json:"documentRef"`
+	Issued          int64  `json:"issued"`
+	IssuedTo        string `json:"issuedTo"`
+}
+
+//==============================================================================================================================
+//	Logbook_Check - The answer to verify_logbook. Doesn't give away the current document reference or the owner.
+//==============================================================================================================================
+
+type Logbook_Check struct {
+	V5cID           string `json:"v5cID"`
+	DocumentRef     string `json:"documentRef"`
+	Current         bool   `json:"current"`
+	Status          string `json:"status"`
+	Issued          int64  `json:"issued,omitempty"`
+}
+
+//==============================================================================================================================
+//	Type_Approval - The regulator's approval for a manufacturer to build a make and model, stored under
+//					type_approval_<manufacturer>_<MAKE>_<MODEL> with the approval number indexed under
+//					approval_number_<number>.
+//==============================================================================================================================
+
+type Type_Approval struct {
+	ApprovalNumber  string `json:"approvalNumber"`
+	Manufacturer    string `json:"manufacturer"`
+	Make            string `json:"make"`
+	Model           string `json:"model"`
+	Status          string `json:"status"`
+	Approved        int64  `json:"approved"`
+	Withdrawn       int64  `json:"withdrawn,omitempty"`
+}
+
+//==============================================================================================================================
+//	Approved_Models - A page of the type approvals in force for a manufacturer, returned by get_approved_models.
+//==============================================================================================================================
+
+type Approved_Models struct {
+	Manufacturer    string          `json:"manufacturer"`
+	Approvals       []Type_Approval `json:"approvals"`
+	Next            string          `json:"next"`
+}
+
+//==============================================================================================================================
+//	Plate - A registration plate, stored under plate_<registration>. An assigned plate is on the vehicle V5cID, a retained
+//			plate is held off the road on the Certificate by the certificate's holder.
+//==============================================================================================================================
+
+type Plate struct {
+	Registration    string                 `json:"registration"`
+	Status          string                 `json:"status"`
+	V5cID           string                 `json:"v5cID,omitempty"`
+	Certificate     *Retention_Certificate `json:"certificate,omitempty"`
+}
+
+//==============================================================================================================================
+//	Retention_Certificate - Entitles the holder to put a retained plate on a vehicle they own until Expiry.
+//==============================================================================================================================
+
+type Retention_Certificate struct {
+	CertificateID   string `json:"certificateID"`
+	Holder          string `json:"holder"`
+	Issued          int64  `json:"issued"`
+	Expiry          int64  `json:"expiry"`
+}
+
+//==============================================================================================================================
+//	Vehicle_Event - The payload of the chaincode event emitted for each transaction that changes vehicles. See Events.
+//==============================================================================================================================
+
+type Vehicle_Event struct {
+	Version         int              `json:"version"`
+	Type            string           `json:"type"`
+	TxID            string           `json:"txID"`
+	Changes         []Vehicle_Change `json:"changes"`
+}
+
+//==============================================================================================================================
+//	Vehicle_Change - A change to one vehicle within a Vehicle_Event.
+//==============================================================================================================================
+
+type Vehicle_Change struct {
+	Type            string   `json:"type"`
+	V5cID           string   `json:"v5cID"`
+	Function        string   `json:"function"`
+	PreviousOwner   string   `json:"previousOwner"`
+	NewOwner        string   `json:"newOwner"`
+	PreviousStatus  int      `json:"previousStatus"`
+	NewStatus       int      `json:"newStatus"`
+	ChangedFields   []string `json:"changedFields"`
+}
+
+//==============================================================================================================================
+//	History_Page - A page of history entries returned by get_vehicle_history. Next is the bookmark to pass to get the
+//				   following page and is empty when there are no more entries.
+//==============================================================================================================================
+
+type History_Page struct {
+	V5cID 	string          `json:"v5cID"`
+	Entries []History_Entry `json:"entries"`
+	Next 	string          `json:"next"`
+}
+
+//==============================================================================================================================
+//	Vehicle_Filter - The filter passed to get_vehicles. Fields left out of the JSON match every vehicle.
+//==============================================================================================================================
+
+type Vehicle_Filter struct {
+	Owner           *string `json:"owner"`
+	Status          *int    `json:"status"`
+	Make            *string `json:"make"`
+	Model           *string `json:"model"`
+	Colour          *string `json:"colour"`
+	Scrapped        *bool   `json:"scrapped"`
+	LeaseContractID *string `json:"leaseContractID"`
+	Keeper          *string `json:"keeper"`
+}
+
+//==============================================================================================================================
+//	Vehicle_Page - A page of vehicles returned by get_vehicles. Next is the bookmark to pass to get the following page and
+//				   is empty when there are no more vehicles. Total is only given when the caller asks for a count, it is
+//				   the number of vehicles matching the filter from the start of this page onwards, on the first page it is
+//				   the total number of matches. Counting reads every vehicle after the page so it isn't done by default.
+//==============================================================================================================================
+
+type Vehicle_Page struct {
+	Vehicles []json.RawMessage `json:"vehicles"`
+	Next     string            `json:"next"`
+	Total    *int              `json:"total,omitempty"`
+}
+
 //==============================================================================================================================
 //	User_and_eCert - Struct for storing the JSON of a user and their ecert
 //==============================================================================================================================
@@ -88,14 +736,6 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string
 	//				0
 	//			peer_address
 
-	var v5cIDs V5C_Holder
-
-	bytes, err := json.Marshal(v5cIDs)
-
-    if err != nil { return nil, errors.New("Error creating V5C_Holder record") }
-
-	err = stub.PutState("v5cIDs", bytes)
-
 	for i:=0; i < len(args); i=i+2 {
 		t.add_ecert(stub, args[i], args[i+1])
 	}
@@ -182,7 +822,7 @@ func (t *SimpleChaincode) get_caller_data(stub shim.ChaincodeStubInterface) (str
 }
 
 //==============================================================================================================================
-//	 retrieve_v5c - Gets the state of the data at v5cID in the ledger then converts it from the stored
+//	 retrieve_v5c - Gets the state of the data at vehicle_<v5cID> in the ledger then converts it from the stored
 //					JSON into the Vehicle struct for use in the contract. Returns the Vehcile struct.
 //					Returns empty v if it errors.
 //==============================================================================================================================
@@ -190,11 +830,11 @@ func (t *SimpleChaincode) retrieve_v5c(stub shim.ChaincodeStubInterface, v5cID s
 
 	var v Vehicle
 
-	bytes, err := stub.GetState(v5cID);
+	bytes, err := stub.GetState("vehicle_" + v5cID);
 
 	if err != nil {	fmt.Printf("RETRIEVE_V5C: Failed to invoke vehicle_code: %s", err); return v, errors.New("RETRIEVE_V5C: Error retrieving vehicle with v5cID = " + v5cID) }
 
-	err = json.Unmarshal(bytes, &v);
+	v, err = t.decode_vehicle(bytes);
 
     if err != nil {	fmt.Printf("RETRIEVE_V5C: Corrupt vehicle record "+string(bytes)+": %s", err); return v, errors.New("RETRIEVE_V5C: Corrupt vehicle record"+string(bytes))	}
 
@@ -202,572 +842,4354 @@ func (t *SimpleChaincode) retrieve_v5c(stub shim.ChaincodeStubInterface, v5cID s
 }
 
 //==============================================================================================================================
-// save_changes - Writes to the ledger the Vehicle struct passed in a JSON format. Uses the shim file's
-//				  method 'PutState'.
+//	 decode_vehicle - Converts a stored vehicle record into a Vehicle. A record with an integer VIN is converted to the
+//					  string form, an unset VIN of 0 becomes "". The record is stored in the new form when it's next saved.
 //==============================================================================================================================
-func (t *SimpleChaincode) save_changes(stub shim.ChaincodeStubInterface, v Vehicle) (bool, error) {
+func (t *SimpleChaincode) decode_vehicle(bytes []byte) (Vehicle, error) {
 
-	bytes, err := json.Marshal(v)
+	var v Vehicle
 
-	if err != nil { fmt.Printf("SAVE_CHANGES: Error converting vehicle record: %s", err); return false, errors.New("Error converting vehicle record") }
+	err := json.Unmarshal(bytes, &v)
+
+	if err == nil { return v, nil }
+
+	var legacy Legacy_Vehicle
+
+	if json.Unmarshal(bytes, &legacy) != nil { return v, err }
+
+	v = legacy.Vehicle
+
+	if legacy.VIN != 0 { v.VIN = strconv.Itoa(legacy.VIN) }
+
+	return v, nil
+}
+
+//==============================================================================================================================
+// save_changes - Writes to the ledger the Vehicle struct passed in a JSON format. Uses the shim file's
+//				  method 'PutState'. The lookup indexes are updated to match, a VIN or registration already used by
+//				  another vehicle is rejected.
+//==============================================================================================================================
+func (t *SimpleChaincode) save_changes(stub shim.ChaincodeStubInterface, v Vehicle) (bool, error) {
+
+	var previous Vehicle
+
+	record, err := stub.GetState("vehicle_" + v.V5cID)
+
+	if err != nil { fmt.Printf("SAVE_CHANGES: Error retrieving vehicle record: %s", err); return false, errors.New("Error retrieving vehicle record") }
+
+	if record != nil {
+		previous, err = t.decode_vehicle(record)
+		if err != nil { return false, errors.New("Corrupt vehicle record") }
+	}
+
+	err = t.update_indexes(stub, previous, v)
+
+	if err != nil { return false, err }
+
+	bytes, err := json.Marshal(v)
+
+	if err != nil { fmt.Printf("SAVE_CHANGES: Error converting vehicle record: %s", err); return false, errors.New("Error converting vehicle record") }
+
+	err = stub.PutState("vehicle_" + v.V5cID, bytes)
+
+	if err != nil { fmt.Printf("SAVE_CHANGES: Error storing vehicle record: %s", err); return false, errors.New("Error storing vehicle record") }
+
+	return true, nil
+}
+
+//==============================================================================================================================
+//	 Lookup indexes - A vehicle can be found by VIN at vin_<VIN> and by owner at owner_<owner>_<v5cID>. Each entry holds
+//					  the v5cID. Unset VINs aren't indexed. A vehicle is found by registration through the plate it has
+//					  been given, see Plate Functions.
+//==============================================================================================================================
+//	 vin_key / plate_key - Return the key of the vehicle's VIN index entry or plate, or "" if it isn't set.
+//==============================================================================================================================
+func (t *SimpleChaincode) vin_key(v Vehicle) string {
+
+	if v.VIN == "" { return "" }
+
+	return "vin_" + v.VIN
+}
+
+func (t *SimpleChaincode) plate_key(v Vehicle) string {
+
+	if v.Reg == "" || v.Reg == "UNDEFINED" { return "" }
+
+	return "plate_" + t.normalise_registration(v.Reg)
+}
+
+//==============================================================================================================================
+//	 update_index - Moves a unique index entry from old_key to new_key. Fails if new_key belongs to another vehicle.
+//==============================================================================================================================
+func (t *SimpleChaincode) update_index(stub shim.ChaincodeStubInterface, v5cID string, old_key string, new_key string, name string) error {
+
+	if old_key == new_key { return nil }
+
+	if new_key != "" {
+
+		holder, err := stub.GetState(new_key)
+
+															if err != nil { return errors.New("Unable to get " + name + " index") }
+															if holder != nil && string(holder) != v5cID { return errors.New(name + " already registered to another vehicle") }
+
+		err = stub.PutState(new_key, []byte(v5cID))
+
+															if err != nil { return errors.New("Unable to store " + name + " index") }
+	}
+
+	if old_key != "" {
+
+		err := stub.DelState(old_key)
+
+															if err != nil { return errors.New("Unable to remove " + name + " index") }
+	}
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 update_indexes - Brings the lookup indexes in line with a change from previous to v. previous is blank for a new vehicle.
+//==============================================================================================================================
+func (t *SimpleChaincode) update_indexes(stub shim.ChaincodeStubInterface, previous Vehicle, v Vehicle) error {
+
+	err := t.update_index(stub, v.V5cID, t.vin_key(previous), t.vin_key(v), "VIN")
+
+															if err != nil { return err }
+
+	err = t.record_plate(stub, v)
+
+															if err != nil { return err }
+
+	if previous.Owner == v.Owner { return nil }
+
+	if previous.Owner != "" {
+
+		err = stub.DelState("owner_" + previous.Owner + "_" + v.V5cID)
+
+															if err != nil { return errors.New("Unable to remove owner index") }
+	}
+
+	err = stub.PutState("owner_" + v.Owner + "_" + v.V5cID, []byte(v.V5cID))
+
+															if err != nil { return errors.New("Unable to store owner index") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 tx_clock - Implemented by a stub that gives the transaction time in seconds rather than as a timestamp. The shim's
+//				MockStub has no transaction timestamp, so the stub the tests run the chaincode on gives the time this way.
+//==============================================================================================================================
+type tx_clock interface {
+	tx_seconds() int64
+}
+
+//==============================================================================================================================
+//	 get_tx_time - Returns the timestamp of the current transaction in seconds since the epoch. Any logic that depends on
+//				   the time must use this rather than a date supplied by the client.
+//==============================================================================================================================
+func (t *SimpleChaincode) get_tx_time(stub shim.ChaincodeStubInterface) (int64, error) {
+
+	if clock, ok := stub.(tx_clock); ok { return clock.tx_seconds(), nil }
+
+	ts, err := stub.GetTxTimestamp()
+
+	if err != nil || ts == nil { return 0, errors.New("Couldn't get transaction timestamp") }
+
+	return ts.Seconds, nil
+}
+
+//==============================================================================================================================
+//	 parse_page_args - Reads the optional page size and bookmark arguments of a paged query starting at args[pos].
+//==============================================================================================================================
+func (t *SimpleChaincode) parse_page_args(args []string, pos int) (int, string, error) {
+
+	page_size := DEFAULT_PAGE_SIZE
+	bookmark  := ""
+
+	if len(args) > pos && args[pos] != "" {
+
+		size, err := strconv.Atoi(args[pos])
+
+															if err != nil || size < 1 { return 0, "", errors.New("Invalid page size " + args[pos]) }
+
+		if size > MAX_PAGE_SIZE { size = MAX_PAGE_SIZE }
+
+		page_size = size
+	}
+
+	if len(args) > pos+1 { bookmark = args[pos+1] }
+
+	return page_size, bookmark, nil
+}
+
+//==============================================================================================================================
+//	 read_range - Reads a page of at most page_size records with keys between start_key and end_key inclusive, in key
+//				  order, starting at the bookmark if one is given. A page_size of 0 reads every record in the range.
+//				  Reading stops at the first key after the page, which is returned as the bookmark for the next page, so a
+//				  page only costs the records on it. The bookmark is empty on the last page.
+//==============================================================================================================================
+func (t *SimpleChaincode) read_range(stub shim.ChaincodeStubInterface, start_key string, end_key string, bookmark string, page_size int) ([]string, [][]byte, string, error) {
+
+	if bookmark > start_key { start_key = bookmark }
+
+	iter, err := stub.RangeQueryState(start_key, end_key)
+
+															if err != nil { return nil, nil, "", errors.New("Unable to query range " + start_key + " - " + end_key) }
+	defer iter.Close()
+
+	var keys []string
+	var values [][]byte
+
+	for iter.HasNext() {
+
+		key, value, err := iter.Next()
+
+															if err != nil { return nil, nil, "", errors.New("Unable to read range " + start_key + " - " + end_key) }
+
+		if key < start_key || key > end_key { continue }
+
+		if page_size > 0 && len(keys) == page_size { return keys, values, key, nil }
+
+		keys   = append(keys, key)
+		values = append(values, value)
+	}
+
+	return keys, values, "", nil
+}
+
+//==============================================================================================================================
+//	 read_vehicles - Reads at most count vehicles in key order starting at the bookmark, from the owner index when an owner
+//					 is given and otherwise from every vehicle. Returns the keys they were read from, the vehicles and the
+//					 bookmark of the record after them, empty if there are no more.
+//==============================================================================================================================
+func (t *SimpleChaincode) read_vehicles(stub shim.ChaincodeStubInterface, owner *string, bookmark string, count int) ([]string, []Vehicle, string, error) {
+
+	prefix := "vehicle_"
+
+	if owner != nil { prefix = "owner_" + *owner + "_" }
+
+	keys, values, next, err := t.read_range(stub, prefix, prefix + "~", bookmark, count)
+
+															if err != nil { return nil, nil, "", errors.New("Unable to get vehicles") }
+
+	vehicles := make([]Vehicle, len(values))
+
+	for i, value := range values {
+
+		if owner != nil {
+			vehicles[i], err = t.retrieve_v5c(stub, string(value))
+		} else {
+			vehicles[i], err = t.decode_vehicle(value)
+		}
+															if err != nil { return nil, nil, "", errors.New("Failed to retrieve V5C") }
+	}
+
+	return keys, vehicles, next, nil
+}
+
+//==============================================================================================================================
+//	 record_history - Adds the change made by function to the event for the transaction and, if it is a change the
+//					  history keeps (see keeps_history), appends an entry describing it to the history of the vehicle.
+//					  previous is the vehicle as it was before the change, the vehicle as it is now is read back from
+//					  the ledger.
+//==============================================================================================================================
+func (t *SimpleChaincode) record_history(stub shim.ChaincodeStubInterface, event *Vehicle_Event, previous Vehicle, function string, caller string) error {
+
+	v, err := t.retrieve_v5c(stub, previous.V5cID)
+
+															if err != nil { return err }
+
+	t.add_change(event, t.vehicle_change(previous, v, function))
+
+	if !t.keeps_history(previous, v, function) { return nil }
+
+	var count History_Count
+
+	bytes, err := stub.GetState("history_" + v.V5cID)
+
+															if err != nil { return errors.New("RECORD_HISTORY: Unable to get history count for " + v.V5cID) }
+
+	if bytes != nil {
+		err = json.Unmarshal(bytes, &count)
+															if err != nil { return errors.New("RECORD_HISTORY: Corrupt history count for " + v.V5cID) }
+	}
+
+	timestamp, err := t.get_tx_time(stub)
+
+															if err != nil { return err }
+
+	entry := History_Entry{
+		V5cID:          v.V5cID,
+		Sequence:       count.Count,
+		Function:       function,
+		Caller:         caller,
+		PreviousOwner:  previous.Owner,
+		NewOwner:       v.Owner,
+		PreviousStatus: previous.Status,
+		NewStatus:      v.Status,
+		TxID:           stub.GetTxID(),
+		Timestamp:      timestamp,
+	}
+
+	bytes, err = json.Marshal(entry)
+
+															if err != nil { return errors.New("RECORD_HISTORY: Error converting history entry") }
+
+	err = stub.PutState(fmt.Sprintf("history_%s_%08d", v.V5cID, count.Count), bytes)
+
+															if err != nil { return errors.New("RECORD_HISTORY: Error storing history entry") }
+
+	count.Count++
+
+	bytes, err = json.Marshal(count)
+
+															if err != nil { return errors.New("RECORD_HISTORY: Error converting history count") }
+
+	err = stub.PutState("history_" + v.V5cID, bytes)
+
+															if err != nil { return errors.New("RECORD_HISTORY: Error storing history count") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 keeps_history - Returns whether the change from previous to v made by function belongs in the vehicle's history. The
+//					 history is a record of the vehicle's V5C: who owned it and in what status, and its registered
+//					 details. It keeps every change of owner or status, whichever function made it, and the changes made
+//					 by create_vehicle, the field updates (update_make, update_model, update_reg, update_vin,
+//					 update_colour and update_vehicle), retain_plate, transfer_plate and scrap_vehicle. Functions that
+//					 keep their own records, e.g. record_odometer, register_lien or record_damage, only add their change
+//					 to the event.
+//==============================================================================================================================
+func (t *SimpleChaincode) keeps_history(previous Vehicle, v Vehicle, function string) bool {
+
+	if previous.Owner != v.Owner || previous.Status != v.Status { return true }
+
+	for _, f := range history_functions {
+		if f == function { return true }
+	}
+
+	return false
+}
+
+//==============================================================================================================================
+//	 vehicle_change - Describes the change from previous to v made by function for a Vehicle_Event.
+//==============================================================================================================================
+func (t *SimpleChaincode) vehicle_change(previous Vehicle, v Vehicle, function string) Vehicle_Change {
+
+	change := Vehicle_Change{
+		V5cID:          v.V5cID,
+		Function:       function,
+		PreviousOwner:  previous.Owner,
+		NewOwner:       v.Owner,
+		PreviousStatus: previous.Status,
+		NewStatus:      v.Status,
+		ChangedFields:  []string{},
+	}
+
+	if 		   function == "create_vehicle"    { change.Type = EVENT_VEHICLE_CREATED
+	} else if  function == "scrap_vehicle"     { change.Type = EVENT_VEHICLE_SCRAPPED
+	} else if  function == "freeze_vehicle"    { change.Type = EVENT_VEHICLE_FROZEN
+	} else if  function == "unfreeze_vehicle"  { change.Type = EVENT_VEHICLE_UNFROZEN
+	} else if  function == "seize_vehicle"     { change.Type = EVENT_VEHICLE_SEIZED
+	} else if  function == "report_stolen"     { change.Type = EVENT_VEHICLE_STOLEN
+	} else if  function == "mark_recovered"    { change.Type = EVENT_VEHICLE_RECOVERED
+	} else if  function == "issue_recall"      { change.Type = EVENT_VEHICLE_RECALLED
+	} else if  previous.WriteOff != v.WriteOff { change.Type = EVENT_VEHICLE_WRITTEN_OFF
+	} else if  previous.Owner  != v.Owner      { change.Type = EVENT_VEHICLE_TRANSFERRED
+	} else if  previous.Status != v.Status     { change.Type = EVENT_VEHICLE_STATUS_CHANGED
+	} else 									   { change.Type = EVENT_VEHICLE_UPDATED }
+
+	var before, after map[string]interface{}
+
+	old_bytes, _ := json.Marshal(previous)
+	new_bytes, _ := json.Marshal(v)
+
+	json.Unmarshal(old_bytes, &before)
+	json.Unmarshal(new_bytes, &after)
+
+	for field, value := range after {
+		if !reflect.DeepEqual(before[field], value) { change.ChangedFields = append(change.ChangedFields, field) }
+	}
+
+	for field := range before {
+		if _, ok := after[field]; !ok { change.ChangedFields = append(change.ChangedFields, field) }		// Fields left out of the JSON once cleared
+	}
+
+	sort.Strings(change.ChangedFields)
+
+	return change
+}
+
+//==============================================================================================================================
+//	 add_change - Adds a change to the event for the current transaction.
+//==============================================================================================================================
+func (t *SimpleChaincode) add_change(event *Vehicle_Event, change Vehicle_Change) {
+
+	if len(event.Changes) == 0 { event.Type = change.Type }
+
+	if event.Type != change.Type { event.Type = EVENT_VEHICLES_CHANGED }
+
+	event.Changes = append(event.Changes, change)
+}
+
+//==============================================================================================================================
+//	 set_event - Sets the event for the transaction on the stub once every change has been added to it. A transaction
+//				 that changed no vehicles sets no event.
+//==============================================================================================================================
+func (t *SimpleChaincode) set_event(stub shim.ChaincodeStubInterface, event Vehicle_Event) error {
+
+	if len(event.Changes) == 0 { return nil }
+
+	bytes, err := json.Marshal(event)
+
+															if err != nil { return errors.New("SET_EVENT: Error converting event") }
+
+	err = stub.SetEvent(event.Type, bytes)
+
+															if err != nil { return errors.New("SET_EVENT: Error setting event") }
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 Router Functions
+//==============================================================================================================================
+//	Invoke - Called on chaincode invoke. Calls route_invoke with an empty event for the transaction, the functions it
+//		  calls add every change they make to the event which is set once the function has succeeded.
+//==============================================================================================================================
+func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+
+	event := Vehicle_Event{Version: EVENT_VERSION, TxID: stub.GetTxID()}
+
+	result, err := t.route_invoke(stub, &event, function, args)
+
+															if err != nil { return result, err }			// A failed function may explain the failure in its result
+
+	err = t.set_event(stub, event)
+
+															if err != nil { return nil, err }
+
+	return result, nil
+}
+
+//==============================================================================================================================
+//	route_invoke - Takes a function name passed and calls that function. Converts some initial arguments passed to
+//		  other things for use in the called function e.g. name -> ecert
+//==============================================================================================================================
+func (t *SimpleChaincode) route_invoke(stub shim.ChaincodeStubInterface, event *Vehicle_Event, function string, args []string) ([]byte, error) {
+
+	caller, caller_affiliation, err := t.get_caller_data(stub)
+
+	if err != nil { return nil, errors.New("Error retrieving caller information")}
+
+
+	if function == "create_vehicle" {
+		_, err = t.create_vehicle(stub, caller, caller_affiliation, args[0])
+
+															if err != nil { return nil, err }
+
+		var blank Vehicle
+		blank.V5cID = args[0]
+
+		return nil, t.record_history(stub, event, blank, function, caller)
+	} else if function == "ping" {
+        return t.ping(stub)
+	} else if t.is_transfer(function) {										// A transfer is offered to the recipient, who takes the vehicle with accept_transfer
+		if len(args) < 2 || len(args) > 3 { return nil, errors.New("Incorrect number of arguments passed") }
+
+		v, err := t.retrieve_v5c(stub, args[1])
+
+															if err != nil { fmt.Printf("INVOKE: Error retrieving v5c: %s", err); return nil, errors.New("Error retrieving v5c") }
+
+		v, err = t.check_lease_expiry(stub, event, v, caller)
+
+															if err != nil { return nil, err }
+
+		err = t.check_function_allowed(v, function)
+
+															if err != nil { return nil, err }
+
+		return t.offer_transfer(stub, v, caller, caller_affiliation, append([]string{args[1], args[0], function}, args[2:]...))
+	} else if function == "offer_transfer" || function == "accept_transfer" || function == "reject_transfer" || function == "cancel_offer" {
+		if len(args) < 1 { return nil, errors.New("Incorrect number of arguments passed") }
+
+		v, err := t.retrieve_v5c(stub, args[0])
+
+															if err != nil { fmt.Printf("INVOKE: Error retrieving v5c: %s", err); return nil, errors.New("Error retrieving v5c") }
+
+		v, err = t.check_lease_expiry(stub, event, v, caller)
+
+															if err != nil { return nil, err }
+
+		err = t.check_function_allowed(v, function)
+
+															if err != nil { return nil, err }
+
+		if 		   function == "offer_transfer"   { return t.offer_transfer(stub, v, caller, caller_affiliation, args)
+		} else if  function == "accept_transfer"  { return t.accept_transfer(stub, event, v, caller, caller_affiliation)
+		} else if  function == "reject_transfer"  { return t.reject_transfer(stub, v, caller, caller_affiliation)
+		} else 									  { return t.cancel_offer(stub, v, caller, caller_affiliation) }
+	} else if function == "transfer_vehicles" {
+		return t.transfer_vehicles(stub, event, caller, caller_affiliation, args)
+	} else if function == "migrate_index" {
+		return t.migrate_index(stub, caller, caller_affiliation)
+	} else if function == "migrate_vins" {
+		return t.migrate_vins(stub, caller, caller_affiliation)
+	} else if function == "register_participant" {
+		return t.register_participant(stub, caller, caller_affiliation, args)
+	} else if function == "update_participant" {
+		return t.update_participant(stub, caller, caller_affiliation, args)
+	} else if function == "suspend_participant" {
+		return t.suspend_participant(stub, caller, caller_affiliation, args)
+	} else if function == "transfer_plate" {
+		return t.transfer_plate(stub, event, caller, caller_affiliation, args)
+	} else if function == "issue_recall" {
+		return t.issue_recall(stub, event, caller, caller_affiliation, args)
+	} else if function == "approve_type" {
+		return t.approve_type(stub, caller, caller_affiliation, args)
+	} else if function == "withdraw_type_approval" {
+		return t.withdraw_type_approval(stub, caller, caller_affiliation, args)
+	} else if function == "set_inspection_policy" {
+		return t.set_inspection_policy(stub, caller, caller_affiliation, args)
+	} else if function == "create_lease" {
+		return t.create_lease(stub, caller, caller_affiliation, args)
+	} else if function == "activate_lease" || function == "record_lease_payment" || function == "terminate_lease" || function == "return_leased_vehicle" {
+		if len(args) < 1 { return nil, errors.New("Incorrect number of arguments passed") }
+
+		l, err := t.retrieve_lease(stub, args[0])
+
+															if err != nil { return nil, err }
+
+		v, err := t.retrieve_v5c(stub, l.V5cID)
+
+															if err != nil { return nil, err }
+
+		err = t.check_function_allowed(v, function)
+
+															if err != nil { return nil, err }
+
+		if 		   function == "activate_lease"        { return t.activate_lease(stub, event, l, caller, caller_affiliation)
+		} else if  function == "record_lease_payment"  { return t.record_lease_payment(stub, event, l, caller, caller_affiliation, args)
+		} else if  function == "terminate_lease"       { return t.terminate_lease(stub, event, l, caller, caller_affiliation)
+		} else 										   { return t.return_leased_vehicle(stub, event, l, caller, caller_affiliation, args) }
+    } else { 																				// If the function is not a create then there must be a car so we need to retrieve the car.
+		argPos := 0																						// The v5cID is expected in the first argument
+
+		if (strings.HasPrefix(function, "update_") && function != "update_vehicle") ||				// except for the field updates and assign_keeper which, like the transfers,
+				function == "assign_keeper" {															// pass the new value first and the v5cID last
+			argPos = 1
+		}
+
+		if len(args) <= argPos { return nil, errors.New("Incorrect number of arguments passed") }
+
+		v, err := t.retrieve_v5c(stub, args[argPos])
+
+        if err != nil { fmt.Printf("INVOKE: Error retrieving v5c: %s", err); return nil, errors.New("Error retrieving v5c") }
+
+		v, err = t.check_lease_expiry(stub, event, v, caller)						// A lease that has run out is ended before anything else is done to the vehicle
+
+															if err != nil { return nil, err }
+
+		err = t.check_function_allowed(v, function)							// Nothing but enforcement and theft reports can change a frozen vehicle
+
+															if err != nil { return nil, err }
+
+		var result []byte
+
+		if 		   function == "update_make"  	    { result, err = t.update_make(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_model"        { result, err = t.update_model(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_reg" { result, err = t.update_registration(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_vin" 			{ result, err = t.update_vin(stub, v, caller, caller_affiliation, args[0])
+        } else if function == "update_colour" 		{ result, err = t.update_colour(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "update_vehicle" 		{
+			if len(args) != 2 { return nil, errors.New("Incorrect number of arguments passed") }
+			result, err = t.update_vehicle(stub, v, caller, caller_affiliation, args[1])
+		} else if function == "scrap_vehicle" 		{ result, err = t.scrap_vehicle(stub, v, caller, caller_affiliation)
+		} else if function == "freeze_vehicle" || function == "seize_vehicle" { result, err = t.freeze_vehicle(stub, v, caller, caller_affiliation, function, args)
+		} else if function == "unfreeze_vehicle"	{ result, err = t.unfreeze_vehicle(stub, v, caller, caller_affiliation, args)
+		} else if function == "report_stolen"		{ result, err = t.report_stolen(stub, v, caller, caller_affiliation, args)
+		} else if function == "mark_recovered"		{ result, err = t.mark_recovered(stub, v, caller, caller_affiliation)
+		} else if function == "record_odometer"		{ result, err = t.record_odometer(stub, v, caller, caller_affiliation, args)
+		} else if function == "mark_odometer_erroneous" { result, err = t.mark_odometer_erroneous(stub, v, caller, caller_affiliation, args)
+		} else if function == "record_inspection"	{ result, err = t.record_inspection(stub, v, caller, caller_affiliation, args)
+		} else if function == "remedy_recall"		{ result, err = t.remedy_recall(stub, v, caller, caller_affiliation, args)
+		} else if function == "register_lien"		{ result, err = t.register_lien(stub, v, caller, caller_affiliation, args)
+		} else if function == "release_lien"		{ result, err = t.release_lien(stub, v, caller, caller_affiliation, args)
+		} else if function == "record_damage"		{ result, err = t.record_damage(stub, v, caller, caller_affiliation, args)
+		} else if function == "tax_vehicle"		{ result, err = t.tax_vehicle(stub, v, caller, caller_affiliation, args)
+		} else if function == "declare_sorn"		{ result, err = t.declare_sorn(stub, v, caller, caller_affiliation)
+		} else if function == "retain_plate"		{ result, err = t.retain_plate(stub, v, caller, caller_affiliation)
+		} else if function == "assign_keeper"		{ result, err = t.assign_keeper(stub, v, caller, caller_affiliation, args[0])
+		} else if function == "release_keeper"		{ result, err = t.release_keeper(stub, v, caller, caller_affiliation)
+		} else { return nil, errors.New("Function of the name "+ function +" doesn't exist.") }
+
+															if err != nil { return nil, err }
+
+		err = t.record_history(stub, event, v, function, caller)						// Every change to a vehicle is added to the event, and to its history if it keeps it
+
+															if err != nil { fmt.Printf("INVOKE: Error recording history: %s", err); return nil, errors.New("Error recording history") }
+
+		return result, nil
+	}
+}
+//=================================================================================================================================
+//	Query - Called on chaincode query. Takes a function name passed and calls that function. Passes the
+//  		initial arguments passed are passed on to the called function.
+//=================================================================================================================================
+func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+
+	caller, caller_affiliation, err := t.get_caller_data(stub)
+	if err != nil { fmt.Printf("QUERY: Error retrieving caller details", err); return nil, errors.New("QUERY: Error retrieving caller details: "+err.Error()) }
+
+    logger.Debug("function: ", function)
+    logger.Debug("caller: ", caller)
+    logger.Debug("affiliation: ", caller_affiliation)
+
+	if function == "get_vehicle_details" {
+		if len(args) != 1 { fmt.Printf("Incorrect number of arguments passed"); return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_v5c(stub, args[0])
+		if err != nil { fmt.Printf("QUERY: Error retrieving v5c: %s", err); return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
+		return t.get_vehicle_details(stub, v, caller, caller_affiliation)
+	} else if function == "get_vehicle_history" {
+		if len(args) < 1 { fmt.Printf("Incorrect number of arguments passed"); return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_v5c(stub, args[0])
+		if err != nil { fmt.Printf("QUERY: Error retrieving v5c: %s", err); return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
+		return t.get_vehicle_history(stub, v, caller, caller_affiliation, args)
+	} else if function == "get_pending_offers" {
+		return t.get_pending_offers(stub, caller, caller_affiliation)
+	} else if function == "get_participants" {
+		return t.get_participants(stub, caller, caller_affiliation, args)
+	} else if function == "get_lifecycle" {
+		return t.get_lifecycle(stub)
+	} else if function == "get_lease" {
+		if len(args) != 1 { fmt.Printf("Incorrect number of arguments passed"); return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		l, err := t.retrieve_lease(stub, args[0])
+		if err != nil { return nil, errors.New("QUERY: Error retrieving lease "+err.Error()) }
+		return t.get_lease(stub, l, caller, caller_affiliation)
+	} else if function == "check_unique_v5c" {
+		return t.check_unique_v5c(stub, args[0], caller, caller_affiliation)
+	} else if function == "get_vehicles" {
+		return t.get_vehicles(stub, caller, caller_affiliation, args)
+	} else if function == "get_vehicle_by_vin" || function == "get_vehicle_by_reg" {
+		if len(args) != 1 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		return t.get_vehicle_by_index(stub, caller, caller_affiliation, function, args[0])
+	} else if function == "get_vehicles_by_owner" {
+		if len(args) < 1 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		return t.get_vehicles_by_owner(stub, caller, caller_affiliation, args)
+	} else if function == "get_odometer_history" {
+		if len(args) < 1 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_v5c(stub, args[0])
+		if err != nil { return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
+		return t.get_odometer_history(stub, v, caller, caller_affiliation, args)
+	} else if function == "get_inspections" {
+		if len(args) < 1 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_v5c(stub, args[0])
+		if err != nil { return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
+		return t.get_inspections(stub, v, caller, caller_affiliation, args)
+	} else if function == "get_open_recalls" {
+		if len(args) != 1 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_v5c(stub, args[0])
+		if err != nil { return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
+		return t.get_open_recalls(stub, v, caller, caller_affiliation)
+	} else if function == "get_inspection_policy" {
+		return t.get_inspection_policy(stub)
+	} else if function == "get_damage_history" {
+		if len(args) < 1 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_v5c(stub, args[0])
+		if err != nil { return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
+		return t.get_damage_history(stub, v, caller, caller_affiliation, args)
+	} else if function == "get_approved_models" {
+		return t.get_approved_models(stub, caller, caller_affiliation, args)
+	} else if function == "get_untaxed_vehicles" {
+		return t.get_untaxed_vehicles(stub, caller, caller_affiliation, args)
+	} else if function == "get_plate" {
+		if len(args) != 1 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		return t.get_plate(stub, caller, caller_affiliation, args[0])
+	} else if function == "verify_logbook" {
+		if len(args) != 2 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_v5c(stub, args[0])
+		if err != nil { return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
+		return t.verify_logbook(stub, v, args[1])
+	} else if function == "check_finance" {
+		if len(args) != 1 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_v5c(stub, args[0])
+		if err != nil { return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
+		return t.check_finance(stub, v, caller, caller_affiliation)
+	} else if function == "check_stolen" {
+		if len(args) != 1 { return nil, errors.New("QUERY: Incorrect number of arguments passed") }
+		v, err := t.retrieve_v5c(stub, args[0])
+		if err != nil { return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
+		return t.check_stolen(v)
+	} else if function == "get_ecert" {
+		return t.get_ecert(stub, args[0])
+	} else if function == "ping" {
+		return t.ping(stub)
+	}
+
+	return nil, errors.New("Received unknown function invocation " + function)
+
+}
+
+//=================================================================================================================================
+//	 Ping Function
+//=================================================================================================================================
+//	 Pings the peer to keep the connection alive
+//=================================================================================================================================
+func (t *SimpleChaincode) ping(stub shim.ChaincodeStubInterface) ([]byte, error) {
+	return []byte("Hello, world!"), nil
+}
+
+//=================================================================================================================================
+//	 Create Function
+//=================================================================================================================================
+//	 Create Vehicle - Creates the initial JSON for the vehcile and then saves it to the ledger.
+//=================================================================================================================================
+func (t *SimpleChaincode) create_vehicle(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, v5cID string) ([]byte, error) {
+	var v Vehicle
+
+	v5c_ID         := "\"v5cID\":\""+v5cID+"\", "							// Variables to define the JSON
+	vin            := "\"VIN\":\"\", "
+	make           := "\"Make\":\"UNDEFINED\", "
+	model          := "\"Model\":\"UNDEFINED\", "
+	reg            := "\"Reg\":\"UNDEFINED\", "
+	owner          := "\"Owner\":\""+caller+"\", "
+	colour         := "\"Colour\":\"UNDEFINED\", "
+	leaseContract  := "\"LeaseContractID\":\"UNDEFINED\", "
+	status         := "\"Status\":0, "
+	scrapped       := "\"Scrapped\":false"
+
+	vehicle_json := "{"+v5c_ID+vin+make+model+reg+owner+colour+leaseContract+status+scrapped+"}" 	// Concatenates the variables to create the total JSON object
+
+	matched, err := regexp.Match("^[A-z][A-z][0-9]{7}", []byte(v5cID))  				// matched = true if the v5cID passed fits format of two letters followed by seven digits
+
+												if err != nil { fmt.Printf("CREATE_VEHICLE: Invalid v5cID: %s", err); return nil, errors.New("Invalid v5cID") }
+
+	if 				v5c_ID  == "" 	 ||
+					matched == false    {
+																		fmt.Printf("CREATE_VEHICLE: Invalid v5cID provided");
+																		return nil, errors.New("Invalid v5cID provided")
+	}
+
+	err = json.Unmarshal([]byte(vehicle_json), &v)							// Convert the JSON defined above into a vehicle object for go
+
+																		if err != nil { return nil, errors.New("Invalid JSON object") }
+
+	record, err := stub.GetState("vehicle_" + v.V5cID) 					// If not an error then a record exists so cant create a new car with this V5cID as it must be unique
+
+																		if record != nil { return nil, errors.New("Vehicle already exists") }
+
+	if 	caller_affiliation != AUTHORITY {							// Only the regulator can create a new v5c
+
+		return nil, errors.New(fmt.Sprintf("Permission Denied. create_vehicle. %v === %v", caller_affiliation, AUTHORITY))
+
+	}
+
+	_, err  = t.save_changes(stub, v)
+
+																		if err != nil { fmt.Printf("CREATE_VEHICLE: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 Migration Functions
+//=================================================================================================================================
+//	 migrate_index - Moves the vehicles listed in an old V5C_Holder record from the key v5cID to vehicle_<v5cID>, adding
+//					 them to the lookup indexes, and then deletes the V5C_Holder. Only the regulator can migrate. Returns the number of vehicles moved.
+//=================================================================================================================================
+func (t *SimpleChaincode) migrate_index(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. migrate_index. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	bytes, err := stub.GetState("v5cIDs")
+
+															if err != nil { return nil, errors.New("Unable to get v5cIDs") }
+															if bytes == nil { return nil, errors.New("MIGRATE_INDEX: Nothing to migrate") }
+
+	var v5cIDs V5C_Holder
+
+	err = json.Unmarshal(bytes, &v5cIDs)
+
+															if err != nil {	return nil, errors.New("Corrupt V5C_Holder record") }
+
+	migrated := 0
+
+	for _, v5cID := range v5cIDs.V5Cs {
+
+		record, err := stub.GetState(v5cID)
+
+															if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to get vehicle " + v5cID) }
+
+		if record == nil { continue }						// Already moved
+
+		existing, err := stub.GetState("vehicle_" + v5cID)
+
+															if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to get vehicle " + v5cID) }
+															if existing != nil { return nil, errors.New("MIGRATE_INDEX: Vehicle " + v5cID + " is stored under both keys") }
+
+		v, err := t.decode_vehicle(record)
+
+															if err != nil { return nil, errors.New("MIGRATE_INDEX: Corrupt vehicle record " + v5cID) }
+
+		_, err = t.save_changes(stub, v)					// Adds the vehicle to the lookup indexes
+
+															if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to store vehicle " + v5cID + ": " + err.Error()) }
+
+		err = stub.DelState(v5cID)
+
+															if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to remove vehicle " + v5cID) }
+
+		migrated++
+	}
+
+	err = stub.DelState("v5cIDs")
+
+															if err != nil { return nil, errors.New("MIGRATE_INDEX: Unable to remove V5C_Holder") }
+
+	return []byte(strconv.Itoa(migrated)), nil
+}
+
+//=================================================================================================================================
+//	 migrate_vins - Rewrites every vehicle stored with an integer VIN so the VIN is stored as a string. Only the regulator
+//					can migrate. The old VINs are kept as they are, they aren't checked against ISO 3779. Returns the
+//					number of vehicles rewritten.
+//=================================================================================================================================
+func (t *SimpleChaincode) migrate_vins(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. migrate_vins. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	_, records, _, err := t.read_range(stub, "vehicle_", "vehicle_~", "", 0)
+
+															if err != nil { return nil, errors.New("Unable to get vehicles") }
+
+	migrated := 0
+
+	for _, record := range records {
+
+		var current Vehicle
+
+		if json.Unmarshal(record, &current) == nil { continue }			// Already has a string VIN
+
+		v, err := t.decode_vehicle(record)
+
+															if err != nil { return nil, errors.New("MIGRATE_VINS: Corrupt vehicle record " + string(record)) }
+
+		_, err = t.save_changes(stub, v)
+
+															if err != nil { return nil, errors.New("MIGRATE_VINS: Unable to store vehicle " + v.V5cID + ": " + err.Error()) }
+
+		migrated++
+	}
+
+	return []byte(strconv.Itoa(migrated)), nil
+}
+
+//=================================================================================================================================
+//	 Participant Functions
+//=================================================================================================================================
+//	 valid_role - Returns true if role is one of the participant types.
+//=================================================================================================================================
+func (t *SimpleChaincode) valid_role(role string) bool {
+
+	return 	role == AUTHORITY		||
+			role == MANUFACTURER	||
+			role == PRIVATE_ENTITY	||
+			role == LEASE_COMPANY	||
+			role == SCRAP_MERCHANT	||
+			role == POLICE			||
+			role == INSPECTOR		||
+			role == LENDER			||
+			role == INSURER
+}
+
+//=================================================================================================================================
+//	 retrieve_participant - Gets the entry for identity from the participant registry.
+//=================================================================================================================================
+func (t *SimpleChaincode) retrieve_participant(stub shim.ChaincodeStubInterface, identity string) (Participant, error) {
+
+	var p Participant
+
+	bytes, err := stub.GetState("participant_" + identity)
+
+															if err != nil { return p, errors.New("RETRIEVE_PARTICIPANT: Error retrieving participant " + identity) }
+															if bytes == nil { return p, errors.New("RETRIEVE_PARTICIPANT: No participant " + identity) }
+
+	err = json.Unmarshal(bytes, &p)
+
+															if err != nil { return p, errors.New("RETRIEVE_PARTICIPANT: Corrupt participant record " + string(bytes)) }
+
+	return p, nil
+}
+
+//=================================================================================================================================
+//	 save_participant - Writes the participant to the registry under participant_<identity>.
+//=================================================================================================================================
+func (t *SimpleChaincode) save_participant(stub shim.ChaincodeStubInterface, p Participant) error {
+
+	bytes, err := json.Marshal(p)
+
+															if err != nil { return errors.New("Error converting participant record") }
+
+	err = stub.PutState("participant_" + p.Identity, bytes)
+
+															if err != nil { return errors.New("Error storing participant record") }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 register_participant - Adds a participant to the registry. Only the regulator can register participants. Takes the
+//							participant as JSON, the identity and role are required.
+//=================================================================================================================================
+func (t *SimpleChaincode) register_participant(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 1 { return nil, errors.New("REGISTER_PARTICIPANT: Incorrect number of arguments passed") }
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. register_participant. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	var p Participant
+
+	err := json.Unmarshal([]byte(args[0]), &p)
+
+															if err != nil { return nil, errors.New("REGISTER_PARTICIPANT: Invalid participant JSON") }
+
+	if p.Identity == "" || !t.valid_role(p.Role) { return nil, errors.New("REGISTER_PARTICIPANT: Invalid identity or role") }
+
+	if p.Type == "" { p.Type = p.Role }
+	if p.Name == "" { p.Name = p.Identity }
+
+	p.Status = PARTICIPANT_ACTIVE
+
+	record, err := stub.GetState("participant_" + p.Identity)
+
+															if err != nil { return nil, errors.New("REGISTER_PARTICIPANT: Error retrieving participant " + p.Identity) }
+															if record != nil { return nil, errors.New("REGISTER_PARTICIPANT: Participant already exists") }
+
+	err = t.save_participant(stub, p)
+
+															if err != nil { fmt.Printf("REGISTER_PARTICIPANT: Error saving participant: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 update_participant - Updates a participant in the registry. Only the regulator can update participants. Takes the
+//						  identity and the fields to change as JSON, fields left out are unchanged. The identity can't
+//						  be changed.
+//=================================================================================================================================
+func (t *SimpleChaincode) update_participant(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 { return nil, errors.New("UPDATE_PARTICIPANT: Incorrect number of arguments passed") }
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. update_participant. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	p, err := t.retrieve_participant(stub, args[0])
+
+															if err != nil { return nil, err }
+
+	var changes Participant
+
+	err = json.Unmarshal([]byte(args[1]), &changes)
+
+															if err != nil { return nil, errors.New("UPDATE_PARTICIPANT: Invalid participant JSON") }
+
+	if changes.Role != "" {
+		if !t.valid_role(changes.Role) { return nil, errors.New("UPDATE_PARTICIPANT: Invalid role " + changes.Role) }
+		p.Role = changes.Role
+	}
+
+	if changes.Status != "" {
+		if changes.Status != PARTICIPANT_ACTIVE && changes.Status != PARTICIPANT_SUSPENDED { return nil, errors.New("UPDATE_PARTICIPANT: Invalid status " + changes.Status) }
+		p.Status = changes.Status
+	}
+
+	if changes.Type        != "" { p.Type        = changes.Type }
+	if changes.Name        != "" { p.Name        = changes.Name }
+	if changes.Address     != nil { p.Address    = changes.Address }
+	if changes.Postcode    != "" { p.Postcode    = changes.Postcode }
+	if changes.EnrolmentID != "" { p.EnrolmentID = changes.EnrolmentID }
+	if changes.WMIs        != nil { p.WMIs       = changes.WMIs }
+
+	err = t.save_participant(stub, p)
+
+															if err != nil { fmt.Printf("UPDATE_PARTICIPANT: Error saving participant: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 suspend_participant - Suspends a participant so that they can no longer receive vehicles. Only the regulator can
+//						   suspend participants. Takes the identity.
+//=================================================================================================================================
+func (t *SimpleChaincode) suspend_participant(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 1 { return nil, errors.New("SUSPEND_PARTICIPANT: Incorrect number of arguments passed") }
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. suspend_participant. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	p, err := t.retrieve_participant(stub, args[0])
+
+															if err != nil { return nil, err }
+
+	p.Status = PARTICIPANT_SUSPENDED
+
+	err = t.save_participant(stub, p)
+
+															if err != nil { fmt.Printf("SUSPEND_PARTICIPANT: Error saving participant: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Transfer Functions
+//=================================================================================================================================
+//	 is_transfer - Returns true if function is the name of a transfer in the lifecycle table.
+//=================================================================================================================================
+func (t *SimpleChaincode) is_transfer(function string) bool {
+
+	for _, tr := range lifecycle {
+		if tr.Function == function { return true }
+	}
+
+	return false
+}
+
+//=================================================================================================================================
+//	 find_transition - Finds the transition in the lifecycle table for function that matches the status of the vehicle and
+//					   the roles of the caller and recipient.
+//=================================================================================================================================
+func (t *SimpleChaincode) find_transition(function string, status int, caller_affiliation string, recipient_affiliation string) (Transition, bool) {
+
+	for _, tr := range lifecycle {
+
+		if 		tr.Function			== function				&&
+				tr.FromStatus		== status				&&
+				tr.CallerRole		== caller_affiliation	&&
+				tr.RecipientRole	== recipient_affiliation {
+
+						return tr, true
+		}
+	}
+
+	return Transition{}, false
+}
+
+//=================================================================================================================================
+//	 field_defined - Returns true if the named field of the vehicle has been given a value.
+//=================================================================================================================================
+func (t *SimpleChaincode) field_defined(v Vehicle, field string) bool {
+
+	switch field {
+		case "make":   return v.Make   != "UNDEFINED"
+		case "model":  return v.Model  != "UNDEFINED"
+		case "reg":    return v.Reg    != "UNDEFINED"
+		case "colour": return v.Colour != "UNDEFINED"
+		case "VIN":    return v.VIN    != ""
+	}
+
+	return false
+}
+
+//=================================================================================================================================
+//	 check_transfer - Checks that the lifecycle table allows the caller to transfer the vehicle to recipient_name with
+//					  function. The recipient must be an active participant in the registry. Returns the transition.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_transfer(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, function string, recipient_name string) (Transition, error) {
+
+	recipient, err := t.retrieve_participant(stub, recipient_name)		// The recipient's role comes from the registry rather than the function name
+
+															if err != nil { fmt.Printf("%s: Unknown recipient %s", strings.ToUpper(function), recipient_name); return Transition{}, errors.New("Unknown recipient " + recipient_name) }
+
+	if recipient.Status != PARTICIPANT_ACTIVE { return Transition{}, errors.New("Recipient " + recipient_name + " is " + recipient.Status) }
+
+	recipient_affiliation := recipient.Role
+
+	err = t.check_not_frozen(v)
+
+															if err != nil { return Transition{}, err }
+
+	err = t.check_not_stolen(v)
+
+															if err != nil { return Transition{}, err }
+
+	err = t.check_not_financed(v)
+
+															if err != nil { return Transition{}, err }
+
+	err = t.check_write_off(v, function)
+
+															if err != nil { return Transition{}, err }
+
+	tr, found := t.find_transition(function, v.Status, caller_affiliation, recipient_affiliation)
+
+	if 		found			== false	||
+			v.Owner			!= caller	||
+			v.Scrapped		!= false	{
+
+		fmt.Printf("%s: Permission Denied", strings.ToUpper(function))
+		return tr, errors.New(fmt.Sprintf("Permission Denied. %s. %v %v, %v === %v, %v, %v, %v === %v", function, v, v.Status, v.Owner, caller, caller_affiliation, recipient_affiliation, v.Scrapped, false))
+	}
+
+	for _, field := range tr.Requires {						// If any required part of the car is undefined it can't be sent
+		if !t.field_defined(v, field) {
+															fmt.Printf("%s: Car not fully defined", strings.ToUpper(function))
+															return tr, errors.New(fmt.Sprintf("Car not fully defined. %v", v))
+		}
+	}
+
+	if function == "manufacturer_to_private" {				// A new vehicle can only leave the manufacturer as an approved type
+
+		_, err = t.check_type_approval(stub, v)
+
+															if err != nil { return tr, err }
+	}
+
+	if tr.RecipientRole == PRIVATE_ENTITY {					// Older vehicles going into private hands may need to be roadworthy
+
+		err = t.check_inspection(stub, v)
+
+															if err != nil { return tr, err }
+	}
+
+	return tr, nil
+}
+
+//=================================================================================================================================
+//	 transfer_vehicle - Transfers the vehicle to recipient_name if the lifecycle table allows the transfer, moving the
+//						vehicle into the new status and issuing a new logbook to the new owner.
+//=================================================================================================================================
+func (t *SimpleChaincode) transfer_vehicle(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, function string, recipient_name string) ([]byte, error) {
+
+	tr, err := t.check_transfer(stub, v, caller, caller_affiliation, function, recipient_name)
+
+															if err != nil { return nil, err }
+
+	v.Owner  = recipient_name
+	v.Status = tr.ToStatus
+	v.Keeper = ""												// A new owner keeps the vehicle until they assign a keeper
+
+	v.TaxStatus  = TAX_UNTAXED									// Tax and SORN don't pass to the new owner
+	v.TaxedUntil = 0
+
+	v, err = t.issue_logbook(stub, v)
+
+															if err != nil { return nil, err }
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("%s: Error saving changes: %s", strings.ToUpper(function), err); return nil, errors.New("Error saving changes") }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 document_ref - Returns an 11 digit reference for a document issued by this transaction for subject. It is derived from
+//					the transaction ID so that every peer issues the same reference.
+//=================================================================================================================================
+func (t *SimpleChaincode) document_ref(stub shim.ChaincodeStubInterface, subject string) string {
+
+	hash := sha256.Sum256([]byte(stub.GetTxID() + "_" + subject))
+
+	return fmt.Sprintf("%011d", binary.BigEndian.Uint64(hash[:8]) % 100000000000)
+}
+
+//=================================================================================================================================
+//	 issue_logbook - Issues a new logbook for the vehicle to its owner, replacing the current one.
+//=================================================================================================================================
+func (t *SimpleChaincode) issue_logbook(stub shim.ChaincodeStubInterface, v Vehicle) (Vehicle, error) {
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return v, err }
+
+	l := Logbook{DocumentRef: t.document_ref(stub, v.V5cID), Issued: now, IssuedTo: v.Owner}
+
+	bytes, err := json.Marshal(l)
+
+															if err != nil { return v, errors.New("Error converting logbook") }
+
+	err = stub.PutState("logbook_" + v.V5cID + "_" + l.DocumentRef, bytes)
+
+															if err != nil { return v, errors.New("Error storing logbook") }
+
+	v.Logbook = &l
+
+	return v, nil
+}
+
+//=================================================================================================================================
+//	 Offer Functions
+//=================================================================================================================================
+//	 retrieve_offer - Gets the offer for the vehicle. Returns false if there is no offer or the offer has expired.
+//=================================================================================================================================
+func (t *SimpleChaincode) retrieve_offer(stub shim.ChaincodeStubInterface, v5cID string) (Transfer_Offer, bool, error) {
+
+	var o Transfer_Offer
+
+	bytes, err := stub.GetState("offer_" + v5cID)
+
+															if err != nil { return o, false, errors.New("RETRIEVE_OFFER: Error retrieving offer for " + v5cID) }
+															if bytes == nil { return o, false, nil }
+
+	err = json.Unmarshal(bytes, &o)
+
+															if err != nil { return o, false, errors.New("RETRIEVE_OFFER: Corrupt offer record " + string(bytes)) }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return o, false, err }
+
+	return o, o.Expiry == 0 || now <= o.Expiry, nil
+}
+
+//=================================================================================================================================
+//	 delete_offer - Removes the offer for the vehicle and its entry in the recipient's index of offers.
+//=================================================================================================================================
+func (t *SimpleChaincode) delete_offer(stub shim.ChaincodeStubInterface, o Transfer_Offer) error {
+
+	err := stub.DelState("offer_" + o.V5cID)
+
+															if err != nil { return errors.New("Error deleting offer for " + o.V5cID) }
+
+	err = stub.DelState("offerto_" + o.Recipient + "_" + o.V5cID)
+
+															if err != nil { return errors.New("Error deleting offer index for " + o.V5cID) }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 save_offer - Writes the offer to the ledger and adds it to the recipient's index of offers.
+//=================================================================================================================================
+func (t *SimpleChaincode) save_offer(stub shim.ChaincodeStubInterface, o Transfer_Offer) error {
+
+	bytes, err := json.Marshal(o)
+
+															if err != nil { return errors.New("Error converting offer") }
+
+	err = stub.PutState("offer_" + o.V5cID, bytes)
+
+															if err != nil { return errors.New("Error storing offer") }
+
+	err = stub.PutState("offerto_" + o.Recipient + "_" + o.V5cID, []byte(o.V5cID))
+
+															if err != nil { return errors.New("Error storing offer index") }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 batch_offers - Returns the offers made together with o, including o. An offer on its own is a batch of one.
+//=================================================================================================================================
+func (t *SimpleChaincode) batch_offers(stub shim.ChaincodeStubInterface, o Transfer_Offer) ([]Transfer_Offer, error) {
+
+	if o.BatchID == "" { return []Transfer_Offer{o}, nil }
+
+	var offers []Transfer_Offer
+
+	for _, v5cID := range o.Batch {
+
+		other, _, err := t.retrieve_offer(stub, v5cID)
+
+															if err != nil { return nil, err }
+
+		if other.BatchID == o.BatchID { offers = append(offers, other) }	// The vehicle may have been offered again since
+	}
+
+	return offers, nil
+}
+
+//=================================================================================================================================
+//	 parse_expiry - Reads the optional expiry time of an offer. Returns 0 if the offer doesn't expire.
+//=================================================================================================================================
+func (t *SimpleChaincode) parse_expiry(stub shim.ChaincodeStubInterface, value string) (int64, error) {
+
+	if value == "" || value == "0" { return 0, nil }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return 0, err }
+
+	expiry, err := strconv.ParseInt(value, 10, 64)
+
+															if err != nil || expiry <= now { return 0, errors.New("Invalid expiry " + value) }
+
+	return expiry, nil
+}
+
+//=================================================================================================================================
+//	 prepare_offer - Checks that the caller can offer the vehicle to the recipient and builds the offer. The vehicle must
+//					 not already have a pending offer, an expired offer is removed.
+//=================================================================================================================================
+func (t *SimpleChaincode) prepare_offer(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, transfer_type string, recipient string, expiry int64) (Transfer_Offer, error) {
+
+	o := Transfer_Offer{V5cID: v.V5cID, From: caller, FromRole: caller_affiliation, Recipient: recipient, TransferType: transfer_type, Expiry: expiry}
+
+	if !t.is_transfer(o.TransferType) { return o, errors.New("Unknown transfer type " + o.TransferType) }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return o, err }
+
+	o.Created = now
+
+	existing, pending, err := t.retrieve_offer(stub, v.V5cID)
+
+															if err != nil { return o, err }
+															if pending { return o, errors.New("Vehicle " + v.V5cID + " already has a pending offer to " + existing.Recipient) }
+
+	if existing.V5cID != "" {							// An expired offer is replaced
+		err = t.delete_offer(stub, existing)
+															if err != nil { return o, err }
+	}
+
+	_, err = t.check_transfer(stub, v, caller, caller_affiliation, o.TransferType, o.Recipient)
+
+	return o, err
+}
+
+//=================================================================================================================================
+//	 offer_transfer - Offers the vehicle to a recipient. Takes the v5cID, the recipient, the transfer type (the name of
+//					  a transfer in the lifecycle table) and optionally the time the offer expires. The transfer is
+//					  checked now and again when the recipient accepts. Returns the result with any open recalls.
+//=================================================================================================================================
+func (t *SimpleChaincode) offer_transfer(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) < 3 || len(args) > 4 { return nil, errors.New("OFFER_TRANSFER: Incorrect number of arguments passed") }
+
+	expiry := int64(0)
+	var err error
+
+	if len(args) == 4 {
+		expiry, err = t.parse_expiry(stub, args[3])
+															if err != nil { return nil, errors.New("OFFER_TRANSFER: " + err.Error()) }
+	}
+
+	o, err := t.prepare_offer(stub, v, caller, caller_affiliation, args[2], args[1], expiry)
+
+															if err != nil { return nil, err }
+
+	err = t.save_offer(stub, o)
+
+															if err != nil { fmt.Printf("OFFER_TRANSFER: Error saving offer: %s", err); return nil, err }
+
+	bytes, err := json.Marshal(Transfer_Result{V5cID: v.V5cID, Result: "offered", OpenRecalls: t.open_recalls(v)})
+
+															if err != nil { return nil, errors.New("OFFER_TRANSFER: Error converting result") }
+
+	return bytes, nil
+}
+
+//=================================================================================================================================
+//	 transfer_vehicles - Offers several vehicles to one recipient as a single batch, as a transfer offers a single vehicle.
+//						 Takes the transfer type, the recipient, a JSON array of v5cIDs and optionally the expiry time.
+//						 Every vehicle is checked before any offer is made, if any vehicle fails no offers are made.
+//						 Returns a result for each vehicle with any open recalls, on failure along with the error.
+//=================================================================================================================================
+func (t *SimpleChaincode) transfer_vehicles(stub shim.ChaincodeStubInterface, event *Vehicle_Event, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) < 3 || len(args) > 4 { return nil, errors.New("TRANSFER_VEHICLES: Incorrect number of arguments passed") }
+
+	var v5cIDs []string
+
+	err := json.Unmarshal([]byte(args[2]), &v5cIDs)
+
+															if err != nil || len(v5cIDs) == 0 { return nil, errors.New("TRANSFER_VEHICLES: Invalid list of v5cIDs") }
+
+	expiry := int64(0)
+
+	if len(args) == 4 {
+		expiry, err = t.parse_expiry(stub, args[3])
+															if err != nil { return nil, errors.New("TRANSFER_VEHICLES: " + err.Error()) }
+	}
+
+	results := make([]Transfer_Result, len(v5cIDs))
+	offers  := make([]Transfer_Offer, len(v5cIDs))
+	seen    := make(map[string]bool)
+	failed  := false
+
+	for i, v5cID := range v5cIDs {								// Check every vehicle before anything is written
+
+		results[i] = Transfer_Result{V5cID: v5cID, Result: "offered"}
+
+		if seen[v5cID] { err = errors.New("Vehicle " + v5cID + " listed more than once") } else { err = nil }
+
+		seen[v5cID] = true
+
+		var v Vehicle
+
+		if err == nil { v, err = t.retrieve_v5c(stub, v5cID) }
+		if err == nil { v, err = t.check_lease_expiry(stub, event, v, caller) }
+		if err == nil { offers[i], err = t.prepare_offer(stub, v, caller, caller_affiliation, args[0], args[1], expiry) }
+
+		results[i].OpenRecalls = t.open_recalls(v)
+
+		if err != nil {
+			results[i].Result = "rejected"
+			results[i].Error  = err.Error()
+			failed = true
+		}
+	}
+
+	bytes, err := json.Marshal(results)
+
+															if err != nil { return nil, errors.New("TRANSFER_VEHICLES: Error converting results") }
+
+	if failed { return bytes, errors.New("TRANSFER_VEHICLES: No vehicles offered") }
+
+	for _, o := range offers {
+
+		o.BatchID = stub.GetTxID()
+		o.Batch   = v5cIDs
+
+		err = t.save_offer(stub, o)
+
+															if err != nil { fmt.Printf("TRANSFER_VEHICLES: Error saving offer: %s", err); return nil, err }
+	}
+
+	return bytes, nil
+}
+
+//=================================================================================================================================
+//	 accept_transfer - Called by the recipient of an offer to accept it. Every offer in its batch is accepted with it.
+//					   Each transfer is checked again as the owner offered it, if any fails none of the vehicles move.
+//					   Returns a result for each vehicle with any open recalls.
+//=================================================================================================================================
+func (t *SimpleChaincode) accept_transfer(stub shim.ChaincodeStubInterface, event *Vehicle_Event, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+
+	o, pending, err := t.retrieve_offer(stub, v.V5cID)
+
+															if err != nil { return nil, err }
+															if !pending { return nil, errors.New("ACCEPT_TRANSFER: No pending offer for " + v.V5cID) }
+
+	if o.Recipient != caller { return nil, errors.New(fmt.Sprintf("Permission Denied. accept_transfer. %v === %v", o.Recipient, caller)) }
+
+	offers, err := t.batch_offers(stub, o)
+
+															if err != nil { return nil, err }
+
+	vehicles := make([]Vehicle, len(offers))
+	results  := make([]Transfer_Result, len(offers))
+
+	for i, offer := range offers {								// Check every transfer before any vehicle moves
+
+		vehicles[i], err = t.retrieve_v5c(stub, offer.V5cID)
+															if err != nil { return nil, err }
+
+		vehicles[i], err = t.check_lease_expiry(stub, event, vehicles[i], caller)
+															if err != nil { return nil, err }
+
+		_, err = t.check_transfer(stub, vehicles[i], offer.From, offer.FromRole, offer.TransferType, offer.Recipient)
+															if err != nil { return nil, errors.New("ACCEPT_TRANSFER: " + offer.V5cID + ": " + err.Error()) }
+	}
+
+	for i, offer := range offers {
+
+		_, err = t.transfer_vehicle(stub, vehicles[i], offer.From, offer.FromRole, offer.TransferType, offer.Recipient)
+															if err != nil { return nil, err }
+
+		err = t.delete_offer(stub, offer)
+															if err != nil { return nil, err }
+
+		err = t.record_history(stub, event, vehicles[i], offer.TransferType, caller)
+															if err != nil { fmt.Printf("ACCEPT_TRANSFER: Error recording history: %s", err); return nil, errors.New("Error recording history") }
+
+		results[i] = Transfer_Result{V5cID: offer.V5cID, Result: "transferred", OpenRecalls: t.open_recalls(vehicles[i])}
+	}
+
+	bytes, err := json.Marshal(results)
+
+															if err != nil { return nil, errors.New("ACCEPT_TRANSFER: Error converting results") }
+
+	return bytes, nil
+}
+
+//=================================================================================================================================
+//	 reject_transfer - Called by the recipient of an offer to turn it down, along with the rest of its batch.
+//=================================================================================================================================
+func (t *SimpleChaincode) reject_transfer(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+
+	o, pending, err := t.retrieve_offer(stub, v.V5cID)
+
+															if err != nil { return nil, err }
+															if !pending { return nil, errors.New("REJECT_TRANSFER: No pending offer for " + v.V5cID) }
+
+	if o.Recipient != caller { return nil, errors.New(fmt.Sprintf("Permission Denied. reject_transfer. %v === %v", o.Recipient, caller)) }
+
+	return nil, t.delete_batch(stub, o)
+}
+
+//=================================================================================================================================
+//	 cancel_offer - Called by the owner of the vehicle to withdraw an offer, pending or expired, along with the rest of
+//					its batch.
+//=================================================================================================================================
+func (t *SimpleChaincode) cancel_offer(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+
+	o, _, err := t.retrieve_offer(stub, v.V5cID)
+
+															if err != nil { return nil, err }
+															if o.V5cID == "" { return nil, errors.New("CANCEL_OFFER: No offer for " + v.V5cID) }
+
+	if o.From != caller && v.Owner != caller { return nil, errors.New(fmt.Sprintf("Permission Denied. cancel_offer. %v === %v", o.From, caller)) }
+
+	return nil, t.delete_batch(stub, o)
+}
+
+//=================================================================================================================================
+//	 delete_batch - Removes every offer in the batch of o.
+//=================================================================================================================================
+func (t *SimpleChaincode) delete_batch(stub shim.ChaincodeStubInterface, o Transfer_Offer) error {
+
+	offers, err := t.batch_offers(stub, o)
+
+															if err != nil { return err }
+
+	for _, offer := range offers {
+
+		err = t.delete_offer(stub, offer)
+															if err != nil { return err }
+	}
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 Update Functions
+//=================================================================================================================================
+//	 update_vehicle - Takes a JSON object of new values keyed by the vehicle's JSON field names (VIN, make, model, reg,
+//					  colour). Each field is checked against the same rules as its update function, the changes are
+//					  only saved if every field is accepted.
+//=================================================================================================================================
+func (t *SimpleChaincode) update_vehicle(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, patch string) ([]byte, error) {
+
+	var values map[string]interface{}
+
+	decoder := json.NewDecoder(strings.NewReader(patch))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&values)
+
+															if err != nil || len(values) == 0 { return nil, errors.New("UPDATE_VEHICLE: Invalid patch") }
+
+	fields := make(map[string]string)
+
+	for field, value := range values {
+
+		switch value.(type) {
+			case string, json.Number: fields[field] = fmt.Sprint(value)
+			default: return nil, errors.New("UPDATE_VEHICLE: Invalid value for " + field)
+		}
+	}
+
+	return t.update_fields(stub, v, caller, caller_affiliation, fields)
+}
+
+//=================================================================================================================================
+//	 update_fields - Applies each new value to the vehicle and saves it if they are all accepted. Fields are applied in a
+//					 fixed order so the result doesn't depend on the order of the patch. A vehicle whose make or model
+//					 changes must still be an approved type once the whole patch is applied.
+//=================================================================================================================================
+func (t *SimpleChaincode) update_fields(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, fields map[string]string) ([]byte, error) {
+
+	var rejected []string
+
+	for field := range fields {
+		if !t.is_vehicle_field(field) { rejected = append(rejected, field + ": Unknown field") }
+	}
+
+	_, new_make      := fields["make"]
+	model, new_model := fields["model"]
+
+	if new_make && new_model { v.Model = model }					// A new make is checked against the new model rather than the old one
+
+	for _, field := range vehicle_fields {
+
+		value, ok := fields[field]
+
+		if !ok { continue }
+
+		var err error
+
+		if 		   field == "VIN"    { v, err = t.set_vin(stub, v, caller, caller_affiliation, value)
+		} else if  field == "make"   { v, err = t.set_make(stub, v, caller, caller_affiliation, value)
+		} else if  field == "model"  { v, err = t.set_model(stub, v, caller, caller_affiliation, value)
+		} else if  field == "reg"    { v, err = t.set_registration(stub, v, caller, caller_affiliation, value)
+		} else 						 { v, err = t.set_colour(v, caller, caller_affiliation, value) }
+
+		if err != nil { rejected = append(rejected, field + ": " + err.Error()) }
+	}
+
+	if len(rejected) == 0 && (new_make || new_model) && v.Model != "UNDEFINED" {
+
+		_, err := t.check_type_approval(stub, v)
+
+		if err != nil { rejected = append(rejected, "type approval: " + err.Error()) }
+	}
+
+	if len(rejected) > 0 {
+		sort.Strings(rejected)
+		return nil, errors.New(strings.Join(rejected, "; "))
+	}
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("UPDATE_FIELDS: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 is_vehicle_field - Returns true if the field can be changed by update_vehicle.
+//=================================================================================================================================
+func (t *SimpleChaincode) is_vehicle_field(field string) bool {
+
+	for _, f := range vehicle_fields {
+		if f == field { return true }
+	}
+
+	return false
+}
+
+//=================================================================================================================================
+//	 update_vin
+//=================================================================================================================================
+func (t *SimpleChaincode) update_vin(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	return t.update_fields(stub, v, caller, caller_affiliation, map[string]string{"VIN": new_value})
+}
+
+//=================================================================================================================================
+//	 set_vin - The VIN must be a valid ISO 3779 VIN whose WMI (the first three characters) is registered to the calling
+//			   manufacturer. The WMI is stored with the VIN.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_vin(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) (Vehicle, error) {
+
+	new_vin := strings.ToUpper(new_value)
+
+	err := t.validate_vin(new_vin)
+
+															if err != nil { return v, err }
+
+	if 		v.Status			== STATE_MANUFACTURE	&&
+			v.Owner				== caller				&&
+			caller_affiliation	== MANUFACTURER			&&
+			v.VIN				== ""					&&			// Can't change the VIN after its initial assignment
+			v.Scrapped			== false				{
+
+					v.VIN = new_vin					// Update to the new value
+					v.WMI = new_vin[:3]
+	} else {
+
+        return v, errors.New(fmt.Sprintf("Permission denied. update_vin %v %v %v %v %v %v", v.Status, STATE_MANUFACTURE, v.Owner, caller, v.VIN, v.Scrapped))
+
+	}
+
+	p, err := t.retrieve_participant(stub, caller)
+
+															if err != nil { return v, err }
+
+	for _, wmi := range p.WMIs {
+		if wmi == v.WMI { return v, nil }
+	}
+
+	return v, errors.New("WMI " + v.WMI + " is not registered to " + caller)
+
+}
+
+//=================================================================================================================================
+//	 validate_vin - Checks a VIN against ISO 3779: 17 characters, digits and letters other than I, O and Q, with the check
+//					digit in position 9 as used in North America.
+//=================================================================================================================================
+func (t *SimpleChaincode) validate_vin(vin string) error {
+
+	matched, err := regexp.Match("^[A-HJ-NPR-Z0-9]{17}$", []byte(vin))
+
+															if err != nil || !matched { return errors.New("Invalid value passed for new VIN") }
+
+	letters := "ABCDEFGHJKLMNPRSTUVWXYZ"
+	values  := "12345678123457923456789"						// The value each letter is transliterated to
+	weights := []int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+	sum := 0
+
+	for i, c := range vin {
+
+		value := c - '0'
+
+		if c >= 'A' { value = rune(values[strings.IndexRune(letters, c)] - '0') }
+
+		sum += int(value) * weights[i]
+	}
+
+	check := "0123456789X"[sum % 11]
+
+	if vin[8] != check { return errors.New("Invalid check digit in VIN " + vin) }
+
+	return nil
+}
+
+
+//=================================================================================================================================
+//	 update_registration
+//=================================================================================================================================
+func (t *SimpleChaincode) update_registration(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	return t.update_fields(stub, v, caller, caller_affiliation, map[string]string{"reg": new_value})
+}
+
+//=================================================================================================================================
+//	 set_registration - Registers the vehicle under a new plate. The manufacturer can only do this while the vehicle is
+//						being built, after that a new registration is only issued by the regulator and an owner can only
+//						move plates it holds through transfer_plate and retain_plate. The registration must be in a UK
+//						format and not already issued.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_registration(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) (Vehicle, error) {
+
+	reg := t.normalise_registration(new_value)
+
+	manufacturer_may_register := v.Owner == caller && caller_affiliation == MANUFACTURER && v.Status == STATE_MANUFACTURE
+
+	if (!manufacturer_may_register && caller_affiliation != AUTHORITY) || v.Scrapped {
+        return v, errors.New(fmt.Sprint("Permission denied. update_registration"))
+	}
+
+	if !registration_formats.MatchString(reg) { return v, errors.New("Invalid registration " + new_value) }
+
+	if reg == t.normalise_registration(v.Reg) { v.Reg = reg; return v, nil }
+
+	existing, err := t.retrieve_plate(stub, reg)
+
+															if err != nil { return v, err }
+															if existing.Status != "" { return v, errors.New("Registration " + reg + " has already been issued") }
+
+	err = t.remove_plate(stub, v)						// The old plate was never issued to anyone else so it can go
+
+															if err != nil { return v, err }
+
+	v.Reg = reg
+
+	return v, t.save_plate(stub, Plate{Registration: reg, Status: PLATE_ASSIGNED, V5cID: v.V5cID})
+}
+
+//=================================================================================================================================
+//	 update_colour
+//=================================================================================================================================
+func (t *SimpleChaincode) update_colour(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	return t.update_fields(stub, v, caller, caller_affiliation, map[string]string{"colour": new_value})
+}
+
+//=================================================================================================================================
+//	 set_colour
+//=================================================================================================================================
+func (t *SimpleChaincode) set_colour(v Vehicle, caller string, caller_affiliation string, new_value string) (Vehicle, error) {
+
+	if 		v.Owner				== caller				&&
+			caller_affiliation	== MANUFACTURER			&&/*((v.Owner				== caller			&&
+			caller_affiliation	== MANUFACTURER)		||
+			caller_affiliation	== AUTHORITY)			&&*/
+			v.Scrapped			== false				{
+
+					v.Colour = new_value
+	} else {
+
+		return v, errors.New(fmt.Sprint("Permission denied. update_colour ", v.Owner == caller, caller_affiliation == MANUFACTURER, v.Scrapped))
+	}
+
+	return v, nil
+
+}
+
+//=================================================================================================================================
+//	 update_make
+//=================================================================================================================================
+func (t *SimpleChaincode) update_make(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	return t.update_fields(stub, v, caller, caller_affiliation, map[string]string{"make": new_value})
+}
+
+//=================================================================================================================================
+//	 set_make - The calling manufacturer must have a type approval in force for the make and the vehicle's model or,
+//				until the model is set, for a model of the make.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_make(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) (Vehicle, error) {
+
+	if 		v.Status			== STATE_MANUFACTURE	&&
+			v.Owner				== caller				&&
+			caller_affiliation	== MANUFACTURER			&&
+			v.Scrapped			== false				{
+
+					v.Make = new_value
+	} else {
+
+        return v, errors.New(fmt.Sprint("Permission denied. update_make ", v.Owner == caller, caller_affiliation == MANUFACTURER, v.Scrapped))
+
+
+	}
+
+	if v.Model != "UNDEFINED" {
+
+		_, err := t.check_type_approval(stub, v)
+
+															if err != nil { return v, err }
+
+		return v, nil
+	}
+
+	approved, err := t.make_approved(stub, caller, new_value)
+
+															if err != nil { return v, err }
+															if !approved { return v, errors.New("No type approval for " + caller + " to build " + new_value) }
+
+	return v, nil
+
+}
+
+//=================================================================================================================================
+//	 update_model
+//=================================================================================================================================
+func (t *SimpleChaincode) update_model(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+
+	return t.update_fields(stub, v, caller, caller_affiliation, map[string]string{"model": new_value})
+}
+
+//=================================================================================================================================
+//	 set_model - The calling manufacturer must have a type approval in force for the model of the vehicle's make.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_model(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) (Vehicle, error) {
+
+	if 		v.Status			== STATE_MANUFACTURE	&&
+			v.Owner				== caller				&&
+			caller_affiliation	== MANUFACTURER			&&
+			v.Scrapped			== false				{
+
+					v.Model = new_value
+
+	} else {
+        return v, errors.New(fmt.Sprint("Permission denied. update_model ", v.Owner == caller, caller_affiliation == MANUFACTURER, v.Scrapped))
+
+	}
+
+	_, err := t.check_type_approval(stub, v)
+
+															if err != nil { return v, err }
+
+	return v, nil
+
+}
+
+//=================================================================================================================================
+//	 scrap_vehicle
+//=================================================================================================================================
+func (t *SimpleChaincode) scrap_vehicle(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+
+	err := t.check_not_stolen(v)
+
+															if err != nil { return nil, err }
+
+	if		v.Status			== STATE_BEING_SCRAPPED	&&
+			v.Owner				== caller				&&
+			caller_affiliation	== SCRAP_MERCHANT		&&
+			v.Scrapped			== false				{
+
+					v.Scrapped = true
+
+	} else {
+		return nil, errors.New("Permission denied. scrap_vehicle")
+	}
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("SCRAP_VEHICLE: Error saving changes: %s", err); return nil, errors.New("SCRAP_VEHICLError saving changes") }
+
+	return nil, nil
+
+}
+
+//=================================================================================================================================
+//	 Enforcement Functions
+//=================================================================================================================================
+//	 check_not_frozen - Returns an error if the regulator has frozen or seized the vehicle.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_not_frozen(v Vehicle) error {
+
+	if !v.Frozen { return nil }
+
+	return errors.New(fmt.Sprintf("Vehicle %s is frozen. Reason %s, case %s", v.V5cID, v.Enforcement.ReasonCode, v.Enforcement.CaseRef))
+}
+
+//=================================================================================================================================
+//	 check_function_allowed - Returns an error if the vehicle is frozen and function would change it. Invoke calls it for
+//							  every function on a vehicle before the function is called. Only the regulator's
+//							  enforcement functions, which freeze, seize and release vehicles, the police's reports of
+//							  a theft and recovery and the functions that leave the vehicle unchanged can be called on a
+//							  frozen vehicle.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_function_allowed(v Vehicle, function string) error {
+
+	if 		function == "freeze_vehicle"		||
+			function == "seize_vehicle"			||
+			function == "unfreeze_vehicle"		||
+			function == "report_stolen"			||
+			function == "mark_recovered"		||
+			function == "reject_transfer"		||
+			function == "cancel_offer"			||
+			function == "record_lease_payment"	{
+
+				return nil
+	}
+
+	return t.check_not_frozen(v)
+}
+
+//=================================================================================================================================
+//	 freeze_vehicle - Called as freeze_vehicle or seize_vehicle by the regulator. Takes the v5cID, a reason code and a case
+//					  reference. Freezing stops the vehicle being transferred or updated, seizing also makes the regulator
+//					  the owner. A frozen vehicle can still be seized.
+//=================================================================================================================================
+func (t *SimpleChaincode) freeze_vehicle(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, function string, args []string) ([]byte, error) {
+
+	if len(args) != 3 || args[1] == "" || args[2] == "" { return nil, errors.New(strings.ToUpper(function) + ": Incorrect number of arguments passed") }
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. %s. %v === %v", function, caller_affiliation, AUTHORITY)) }
+
+	if v.Frozen && (function == "freeze_vehicle" || v.Enforcement.Action == ENFORCEMENT_SEIZE) { return nil, errors.New(fmt.Sprintf("Vehicle %s is already under %s, case %s", v.V5cID, v.Enforcement.Action, v.Enforcement.CaseRef)) }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	e := Enforcement{Action: ENFORCEMENT_FREEZE, ReasonCode: args[1], CaseRef: args[2], Officer: caller, Date: now}
+
+	if function == "seize_vehicle" {
+		e.Action        = ENFORCEMENT_SEIZE
+		e.PreviousOwner = v.Owner
+		v.Owner         = caller
+	}
+
+	v.Frozen      = true
+	v.Enforcement = &e
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("FREEZE_VEHICLE: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 unfreeze_vehicle - Called by the regulator to release a frozen or seized vehicle. Takes the v5cID and the case
+//						reference it was frozen under. A seized vehicle goes back to the owner it was seized from.
+//=================================================================================================================================
+func (t *SimpleChaincode) unfreeze_vehicle(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 { return nil, errors.New("UNFREEZE_VEHICLE: Incorrect number of arguments passed") }
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. unfreeze_vehicle. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	if !v.Frozen { return nil, errors.New("UNFREEZE_VEHICLE: Vehicle " + v.V5cID + " isn't frozen") }
+
+	if v.Enforcement.CaseRef != args[1] { return nil, errors.New("UNFREEZE_VEHICLE: Vehicle " + v.V5cID + " is frozen under case " + v.Enforcement.CaseRef) }
+
+	if v.Enforcement.Action == ENFORCEMENT_SEIZE { v.Owner = v.Enforcement.PreviousOwner }
+
+	v.Frozen      = false
+	v.Enforcement = nil
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("UNFREEZE_VEHICLE: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Stolen Vehicle Functions
+//=================================================================================================================================
+//	 check_not_stolen - Returns an error if the vehicle has been reported stolen.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_not_stolen(v Vehicle) error {
+
+	if v.Stolen == nil { return nil }
+
+	return errors.New("Vehicle " + v.V5cID + " is reported stolen, crime reference " + v.Stolen.CrimeRef)
+}
+
+//=================================================================================================================================
+//	 report_stolen - Called by the police or the owner to report the vehicle stolen. Takes the v5cID and the crime reference.
+//=================================================================================================================================
+func (t *SimpleChaincode) report_stolen(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 || args[1] == "" { return nil, errors.New("REPORT_STOLEN: Incorrect number of arguments passed") }
+
+	if caller_affiliation != POLICE && v.Owner != caller { return nil, errors.New(fmt.Sprintf("Permission Denied. report_stolen. %v === %v", v.Owner, caller)) }
+
+	if v.Stolen != nil { return nil, errors.New("REPORT_STOLEN: Vehicle " + v.V5cID + " is already reported stolen, crime reference " + v.Stolen.CrimeRef) }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	v.Stolen = &Theft_Report{CrimeRef: args[1], ReportedBy: caller, Date: now}
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("REPORT_STOLEN: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 mark_recovered - Called by the police to clear the theft report once the vehicle is recovered.
+//=================================================================================================================================
+func (t *SimpleChaincode) mark_recovered(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+
+	if caller_affiliation != POLICE { return nil, errors.New(fmt.Sprintf("Permission Denied. mark_recovered. %v === %v", caller_affiliation, POLICE)) }
+
+	if v.Stolen == nil { return nil, errors.New("MARK_RECOVERED: Vehicle " + v.V5cID + " isn't reported stolen") }
+
+	v.Stolen = nil
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("MARK_RECOVERED: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Odometer Functions
+//=================================================================================================================================
+//	 record_odometer - Records a reading of the vehicle's odometer. Takes the v5cID, the miles shown and the source of the
+//					   reading (e.g. service, sale). Can be called by the owner, the keeper, a dealership or an inspector. A reading
+//					   below the vehicle's current mileage is kept but flags the vehicle as having a mileage discrepancy
+//					   and doesn't change its mileage, the regulator has to mark the higher reading as erroneous first.
+//=================================================================================================================================
+func (t *SimpleChaincode) record_odometer(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 3 || args[2] == "" { return nil, errors.New("RECORD_ODOMETER: Incorrect number of arguments passed") }
+
+	miles, err := strconv.Atoi(args[1])
+
+															if err != nil || miles < 0 { return nil, errors.New("RECORD_ODOMETER: Invalid mileage " + args[1]) }
+
+	if v.Owner != caller && v.Keeper != caller && caller_affiliation != INSPECTOR {
+
+		p, err := t.retrieve_participant(stub, caller)
+
+		if err != nil || p.Type != DEALERSHIP || p.Status != PARTICIPANT_ACTIVE { return nil, errors.New(fmt.Sprintf("Permission Denied. record_odometer. %v === %v", v.Owner, caller)) }
+	}
+
+	v, err = t.add_odometer_reading(stub, v, miles, args[2], caller)
+
+															if err != nil { return nil, errors.New("RECORD_ODOMETER: " + err.Error()) }
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("RECORD_ODOMETER: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 add_odometer_reading - Appends a reading to the vehicle's odometer readings and returns the vehicle with its mileage
+//							set to the reading. A reading below the current mileage is a sign the odometer has been wound
+//							back, the vehicle is flagged with a mileage discrepancy instead. Doesn't save the vehicle.
+//=================================================================================================================================
+func (t *SimpleChaincode) add_odometer_reading(stub shim.ChaincodeStubInterface, v Vehicle, miles int, source string, caller string) (Vehicle, error) {
+
+	var count History_Count
+
+	bytes, err := stub.GetState("odometer_" + v.V5cID)
+
+															if err != nil { return v, errors.New("Unable to get odometer count for " + v.V5cID) }
+
+	if bytes != nil {
+		err = json.Unmarshal(bytes, &count)
+															if err != nil { return v, errors.New("Corrupt odometer count for " + v.V5cID) }
+	}
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return v, err }
+
+	r := Odometer_Reading{V5cID: v.V5cID, Sequence: count.Count, Miles: miles, Source: source, RecordedBy: caller, Date: now}
+
+	err = t.save_odometer_reading(stub, r)
+
+															if err != nil { return v, err }
+
+	count.Count++
+
+	bytes, err = json.Marshal(count)
+
+															if err != nil { return v, errors.New("Error converting odometer count") }
+
+	err = stub.PutState("odometer_" + v.V5cID, bytes)
+
+															if err != nil { return v, errors.New("Error storing odometer count") }
+
+	if miles < v.Mileage { v.MileageDiscrepancy = true } else { v.Mileage = miles }
+
+	return v, nil
+}
+
+//=================================================================================================================================
+//	 save_odometer_reading - Writes an odometer reading to the ledger.
+//=================================================================================================================================
+func (t *SimpleChaincode) save_odometer_reading(stub shim.ChaincodeStubInterface, r Odometer_Reading) error {
+
+	bytes, err := json.Marshal(r)
+
+															if err != nil { return errors.New("Error converting odometer reading") }
+
+	err = stub.PutState(fmt.Sprintf("odometer_%s_%08d", r.V5cID, r.Sequence), bytes)
+
+															if err != nil { return errors.New("Error storing odometer reading") }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 mark_odometer_erroneous - Called by the regulator to mark a reading as erroneous. Takes the v5cID and the sequence
+//							   number of the reading. The vehicle's mileage goes back to the highest reading that isn't
+//							   erroneous and the vehicle is flagged as having a mileage discrepancy.
+//=================================================================================================================================
+func (t *SimpleChaincode) mark_odometer_erroneous(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 { return nil, errors.New("MARK_ODOMETER_ERRONEOUS: Incorrect number of arguments passed") }
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. mark_odometer_erroneous. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	sequence, err := strconv.Atoi(args[1])
+
+															if err != nil { return nil, errors.New("MARK_ODOMETER_ERRONEOUS: Invalid reading " + args[1]) }
+
+	prefix := "odometer_" + v.V5cID + "_"
+
+	_, values, _, err := t.read_range(stub, prefix, prefix + "~", "", 0)
+
+															if err != nil { return nil, err }
+
+	found := false
+	v.Mileage = 0
+
+	for _, value := range values {
+
+		var r Odometer_Reading
+
+		err = json.Unmarshal(value, &r)
+
+															if err != nil { return nil, errors.New("MARK_ODOMETER_ERRONEOUS: Corrupt odometer reading " + string(value)) }
+
+		if r.Sequence == sequence {
+
+			if r.Erroneous { return nil, errors.New("MARK_ODOMETER_ERRONEOUS: Reading " + args[1] + " is already marked erroneous") }
+
+			r.Erroneous = true
+			found       = true
+
+			err = t.save_odometer_reading(stub, r)
+
+															if err != nil { return nil, err }
+		}
+
+		if !r.Erroneous && r.Miles > v.Mileage { v.Mileage = r.Miles }	// A lower reading after a higher one doesn't lower the mileage
+	}
+
+	if !found { return nil, errors.New("MARK_ODOMETER_ERRONEOUS: No reading " + args[1] + " for " + v.V5cID) }
+
+	v.MileageDiscrepancy = true
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("MARK_ODOMETER_ERRONEOUS: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Inspection Functions
+//=================================================================================================================================
+//	 record_inspection - Called by an inspector to record a roadworthiness inspection of the vehicle. Takes the v5cID, the
+//						 result (pass or fail), the expiry date, the advisories and failure items as JSON arrays of strings
+//						 and optionally the odometer reading, which is recorded as an odometer reading too.
+//=================================================================================================================================
+func (t *SimpleChaincode) record_inspection(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 5 && len(args) != 6 { return nil, errors.New("RECORD_INSPECTION: Incorrect number of arguments passed") }
+
+	if caller_affiliation != INSPECTOR { return nil, errors.New(fmt.Sprintf("Permission Denied. record_inspection. %v === %v", caller_affiliation, INSPECTOR)) }
+
+	if v.Scrapped { return nil, errors.New("RECORD_INSPECTION: Vehicle " + v.V5cID + " has been scrapped") }
+
+	i := Inspection{V5cID: v.V5cID, Result: args[1], Inspector: caller}
+
+	if i.Result != INSPECTION_PASS && i.Result != INSPECTION_FAIL { return nil, errors.New("RECORD_INSPECTION: Invalid result " + args[1]) }
+
+	var err error
+
+	i.Expiry, err = strconv.ParseInt(args[2], 10, 64)
+
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: Invalid expiry date " + args[2]) }
+
+	err = json.Unmarshal([]byte(args[3]), &i.Advisories)
+
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: Invalid advisories " + args[3]) }
+
+	err = json.Unmarshal([]byte(args[4]), &i.Failures)
+
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: Invalid failure items " + args[4]) }
+
+	if i.Advisories == nil { i.Advisories = []string{} }
+	if i.Failures   == nil { i.Failures   = []string{} }
+
+	if i.Result == INSPECTION_FAIL && len(i.Failures) == 0 { return nil, errors.New("RECORD_INSPECTION: A failed inspection must list the failure items") }
+
+	i.Date, err = t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	if i.Expiry <= i.Date { return nil, errors.New("RECORD_INSPECTION: Expiry date must be in the future") }
+
+	if len(args) == 6 {
+
+		i.Miles, err = strconv.Atoi(args[5])
+
+															if err != nil || i.Miles < 0 { return nil, errors.New("RECORD_INSPECTION: Invalid mileage " + args[5]) }
+
+		v, err = t.add_odometer_reading(stub, v, i.Miles, "inspection", caller)
+
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: " + err.Error()) }
+	}
+
+	var count History_Count
+
+	bytes, err := stub.GetState("inspection_" + v.V5cID)
+
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: Unable to get inspection count for " + v.V5cID) }
+
+	if bytes != nil {
+		err = json.Unmarshal(bytes, &count)
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: Corrupt inspection count for " + v.V5cID) }
+	}
+
+	i.Sequence = count.Count
+
+	bytes, err = json.Marshal(i)
+
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: Error converting inspection") }
+
+	err = stub.PutState(fmt.Sprintf("inspection_%s_%08d", v.V5cID, i.Sequence), bytes)
+
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: Error storing inspection") }
+
+	count.Count++
+
+	bytes, err = json.Marshal(count)
+
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: Error converting inspection count") }
+
+	err = stub.PutState("inspection_" + v.V5cID, bytes)
+
+															if err != nil { return nil, errors.New("RECORD_INSPECTION: Error storing inspection count") }
+
+	v.Inspection = &i
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("RECORD_INSPECTION: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 retrieve_inspection_policy - Gets the regulator's inspection policy. Returns a policy with the rule turned off if the
+//								  regulator hasn't set one.
+//=================================================================================================================================
+func (t *SimpleChaincode) retrieve_inspection_policy(stub shim.ChaincodeStubInterface) (Inspection_Policy, error) {
+
+	var policy Inspection_Policy
+
+	bytes, err := stub.GetState("inspection_policy")
+
+															if err != nil { return policy, errors.New("Unable to get inspection policy") }
+
+	if bytes == nil { return policy, nil }
+
+	err = json.Unmarshal(bytes, &policy)
+
+															if err != nil { return policy, errors.New("Corrupt inspection policy " + string(bytes)) }
+
+	return policy, nil
+}
+
+//=================================================================================================================================
+//	 set_inspection_policy - Called by the regulator to set the age in years from which a vehicle needs a valid inspection
+//							 to be transferred into private ownership. An age of 0 turns the rule off.
+//=================================================================================================================================
+func (t *SimpleChaincode) set_inspection_policy(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 1 { return nil, errors.New("SET_INSPECTION_POLICY: Incorrect number of arguments passed") }
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. set_inspection_policy. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	age, err := strconv.Atoi(args[0])
+
+															if err != nil || age < 0 { return nil, errors.New("SET_INSPECTION_POLICY: Invalid age " + args[0]) }
+
+	bytes, err := json.Marshal(Inspection_Policy{MinimumAge: age})
+
+															if err != nil { return nil, errors.New("SET_INSPECTION_POLICY: Error converting inspection policy") }
+
+	err = stub.PutState("inspection_policy", bytes)
+
+															if err != nil { return nil, errors.New("SET_INSPECTION_POLICY: Error storing inspection policy") }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 vehicle_created - Returns the date the vehicle was created, the timestamp of the first entry in its history. Returns
+//					   false for a vehicle created before history was recorded, its age isn't known.
+//=================================================================================================================================
+func (t *SimpleChaincode) vehicle_created(stub shim.ChaincodeStubInterface, v Vehicle) (int64, bool, error) {
+
+	bytes, err := stub.GetState(fmt.Sprintf("history_%s_%08d", v.V5cID, 0))
+
+															if err != nil { return 0, false, errors.New("Unable to get history of " + v.V5cID) }
+
+	if bytes == nil { return 0, false, nil }
+
+	var entry History_Entry
+
+	err = json.Unmarshal(bytes, &entry)
+
+															if err != nil { return 0, false, errors.New("Corrupt history entry " + string(bytes)) }
+
+	return entry.Timestamp, true, nil
+}
+
+//=================================================================================================================================
+//	 check_inspection - Returns an error if the inspection policy requires the vehicle to have a valid inspection and it
+//						doesn't. A vehicle whose age isn't known is treated as old enough to need one.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_inspection(stub shim.ChaincodeStubInterface, v Vehicle) error {
+
+	policy, err := t.retrieve_inspection_policy(stub)
+
+															if err != nil { return err }
+
+	if policy.MinimumAge == 0 { return nil }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return err }
+
+	created, known, err := t.vehicle_created(stub, v)
+
+															if err != nil { return err }
+
+	if known && now - created < int64(policy.MinimumAge) * SECONDS_PER_YEAR { return nil }
+
+	if 		v.Inspection		== nil				||
+			v.Inspection.Result	!= INSPECTION_PASS	||
+			v.Inspection.Expiry	<= now				{
+
+		return errors.New(fmt.Sprintf("Vehicle %s needs a valid inspection, it is over %d years old", v.V5cID, policy.MinimumAge))
+	}
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 Recall Functions
+//=================================================================================================================================
+//	 issue_recall - Called by a manufacturer to recall vehicles it built. Takes the recallID, make, model and a
+//					description of the defect, then either the first and last VIN of a range or a JSON array of VINs.
+//					The check digit is ignored when comparing VINs with the range.
+//					Every vehicle of the make and model found with one of those VINs and a WMI registered to the
+//					manufacturer is given an open recall. Returns the recall.
+//=================================================================================================================================
+func (t *SimpleChaincode) issue_recall(stub shim.ChaincodeStubInterface, event *Vehicle_Event, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 5 && len(args) != 6 { return nil, errors.New("ISSUE_RECALL: Incorrect number of arguments passed") }
+
+	if caller_affiliation != MANUFACTURER { return nil, errors.New(fmt.Sprintf("Permission Denied. issue_recall. %v === %v", caller_affiliation, MANUFACTURER)) }
+
+	r := Recall{RecallID: args[0], Manufacturer: caller, Make: args[1], Model: args[2], Description: args[3], Vehicles: []string{}}
+
+	if r.RecallID == "" || r.Make == "" || r.Model == "" || r.Description == "" { return nil, errors.New("ISSUE_RECALL: recallID, make, model and description are required") }
+
+	record, err := stub.GetState("recall_" + r.RecallID)
+
+															if err != nil { return nil, errors.New("ISSUE_RECALL: Unable to look up recall " + r.RecallID + ": " + err.Error()) }
+															if record != nil { return nil, errors.New("ISSUE_RECALL: Recall " + r.RecallID + " already exists") }
+
+	var v5cIDs []string
+
+	if len(args) == 6 {											// A range of VINs is read from the VIN index
+
+		r.VINFrom = strings.ToUpper(args[4])
+		r.VINTo   = strings.ToUpper(args[5])
+
+		from, to := t.serial_key(r.VINFrom), t.serial_key(r.VINTo)
+
+		if len(r.VINFrom) != 17 || len(r.VINTo) != 17 || to < from { return nil, errors.New("ISSUE_RECALL: Invalid VIN range " + args[4] + " - " + args[5]) }
+
+		keys, values, _, err := t.read_range(stub, "vin_" + r.VINFrom[:8], "vin_" + r.VINTo[:8] + "~", "", 0)
+
+															if err != nil { return nil, err }
+
+		for i, key := range keys {
+
+			serial := t.serial_key(strings.TrimPrefix(key, "vin_"))
+
+			if serial >= from && serial <= to { v5cIDs = append(v5cIDs, string(values[i])) }
+		}
+
+	} else {
+
+		err = json.Unmarshal([]byte(args[4]), &r.VINs)
+
+															if err != nil || len(r.VINs) == 0 { return nil, errors.New("ISSUE_RECALL: Invalid list of VINs " + args[4]) }
+
+		for i, vin := range r.VINs {
+
+			r.VINs[i] = strings.ToUpper(vin)
+
+			value, err := stub.GetState("vin_" + r.VINs[i])
+
+															if err != nil { return nil, errors.New("ISSUE_RECALL: Unable to look up VIN " + vin + ": " + err.Error()) }
+
+			if value != nil { v5cIDs = append(v5cIDs, string(value)) }
+		}
+	}
+
+	p, err := t.retrieve_participant(stub, caller)
+
+															if err != nil { return nil, err }
+
+	wmis := make(map[string]bool)
+
+	for _, wmi := range p.WMIs { wmis[wmi] = true }
+
+	r.Issued, err = t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	for _, v5cID := range v5cIDs {
+
+		v, err := t.retrieve_v5c(stub, v5cID)
+
+															if err != nil { return nil, err }
+
+		if v.Make != r.Make || v.Model != r.Model || !wmis[v.WMI] || v.Scrapped { continue }
+
+		previous := v
+
+		v.Recalls = append(append([]Vehicle_Recall{}, v.Recalls...), Vehicle_Recall{RecallID: r.RecallID, Description: r.Description, Status: RECALL_OPEN, Issued: r.Issued})
+
+		_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("ISSUE_RECALL: Error saving changes: %s", err); return nil, err }
+
+		err = t.record_history(stub, event, previous, "issue_recall", caller)
+
+															if err != nil { fmt.Printf("ISSUE_RECALL: Error recording history: %s", err); return nil, errors.New("Error recording history") }
+
+		r.Vehicles = append(r.Vehicles, v.V5cID)
+	}
+
+	if len(r.Vehicles) == 0 { return nil, errors.New("ISSUE_RECALL: No vehicles of yours match the recall") }
+
+	bytes, err := json.Marshal(r)
+
+															if err != nil { return nil, errors.New("ISSUE_RECALL: Error converting recall") }
+
+	err = stub.PutState("recall_" + r.RecallID, bytes)
+
+															if err != nil { return nil, errors.New("ISSUE_RECALL: Error storing recall") }
+
+	return bytes, nil
+}
+
+//=================================================================================================================================
+//	 serial_key - Returns the VIN without its check digit, so that VINs sort by manufacturer, vehicle type and serial number.
+//=================================================================================================================================
+func (t *SimpleChaincode) serial_key(vin string) string {
+
+	if len(vin) != 17 { return vin }
+
+	return vin[:8] + vin[9:]
+}
+
+//=================================================================================================================================
+//	 remedy_recall - Called by a dealership to record that it has carried out the remedy for a recall on the vehicle.
+//					 Takes the v5cID and the recallID.
+//=================================================================================================================================
+func (t *SimpleChaincode) remedy_recall(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 { return nil, errors.New("REMEDY_RECALL: Incorrect number of arguments passed") }
+
+	p, err := t.retrieve_participant(stub, caller)
+
+	if err != nil || p.Type != DEALERSHIP || p.Status != PARTICIPANT_ACTIVE { return nil, errors.New(fmt.Sprintf("Permission Denied. remedy_recall. %v is not an active dealership", caller)) }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	recalls := append([]Vehicle_Recall{}, v.Recalls...)		// Copied so the vehicle passed in still shows the recall as it was
+
+	for i := range recalls {
+
+		if recalls[i].RecallID != args[1] { continue }
+
+		if recalls[i].Status != RECALL_OPEN { return nil, errors.New("REMEDY_RECALL: Recall " + args[1] + " has already been remedied on " + v.V5cID) }
+
+		recalls[i].Status     = RECALL_REMEDIED
+		recalls[i].Remedied   = now
+		recalls[i].RemediedBy = caller
+
+		v.Recalls = recalls
+
+		_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("REMEDY_RECALL: Error saving changes: %s", err); return nil, err }
+
+		return nil, nil
+	}
+
+	return nil, errors.New("REMEDY_RECALL: Vehicle " + v.V5cID + " is not part of recall " + args[1])
+}
+
+//=================================================================================================================================
+//	 open_recalls - Returns the recalls on the vehicle that haven't been remedied, nil if there are none.
+//=================================================================================================================================
+func (t *SimpleChaincode) open_recalls(v Vehicle) []Vehicle_Recall {
+
+	var open []Vehicle_Recall
+
+	for _, r := range v.Recalls {
+		if r.Status == RECALL_OPEN { open = append(open, r) }
+	}
+
+	return open
+}
+
+//=================================================================================================================================
+//	 Finance Functions
+//=================================================================================================================================
+//	 check_not_financed - Returns an error if a lien on the vehicle is active, it can't be transferred until the lender
+//						  releases it.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_not_financed(v Vehicle) error {
+
+	if !v.Financed { return nil }
+
+	return errors.New("Vehicle " + v.V5cID + " has outstanding finance")
+}
+
+//=================================================================================================================================
+//	 retrieve_liens - Gets every lien registered on the vehicle, active or released.
+//=================================================================================================================================
+func (t *SimpleChaincode) retrieve_liens(stub shim.ChaincodeStubInterface, v5cID string) ([]Lien, error) {
+
+	prefix := "lien_" + v5cID + "_"
+
+	_, values, _, err := t.read_range(stub, prefix, prefix + "~", "", 0)
+
+															if err != nil { return nil, err }
+
+	liens := []Lien{}
+
+	for _, value := range values {
+
+		var l Lien
+
+		err = json.Unmarshal(value, &l)
+
+															if err != nil { return nil, errors.New("Corrupt lien record " + string(value)) }
+
+		liens = append(liens, l)
+	}
+
+	return liens, nil
+}
+
+//=================================================================================================================================
+//	 save_lien - Writes a lien to the ledger.
+//=================================================================================================================================
+func (t *SimpleChaincode) save_lien(stub shim.ChaincodeStubInterface, l Lien) error {
+
+	bytes, err := json.Marshal(l)
+
+															if err != nil { return errors.New("Error converting lien record") }
+
+	err = stub.PutState("lien_" + l.V5cID + "_" + l.LienID, bytes)
+
+															if err != nil { return errors.New("Error storing lien record") }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 register_lien - Called by a lender to register its financial interest in a vehicle it doesn't own. Takes the v5cID,
+//					 the lienID (the lender's agreement reference) and the amount outstanding in pence.
+//=================================================================================================================================
+func (t *SimpleChaincode) register_lien(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 3 || args[1] == "" { return nil, errors.New("REGISTER_LIEN: Incorrect number of arguments passed") }
+
+	if caller_affiliation != LENDER { return nil, errors.New(fmt.Sprintf("Permission Denied. register_lien. %v === %v", caller_affiliation, LENDER)) }
+
+	if v.Owner == caller { return nil, errors.New("REGISTER_LIEN: A lender can't register a lien on its own vehicle " + v.V5cID) }
+
+	if v.Scrapped { return nil, errors.New("REGISTER_LIEN: Vehicle " + v.V5cID + " has been scrapped") }
+
+	amount, err := strconv.Atoi(args[2])
+
+															if err != nil || amount <= 0 { return nil, errors.New("REGISTER_LIEN: Invalid amount " + args[2]) }
+
+	record, err := stub.GetState("lien_" + v.V5cID + "_" + args[1])
+
+															if err != nil { return nil, errors.New("REGISTER_LIEN: Unable to look up lien " + args[1] + ": " + err.Error()) }
+															if record != nil { return nil, errors.New("REGISTER_LIEN: Lien " + args[1] + " already registered on " + v.V5cID) }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	err = t.save_lien(stub, Lien{LienID: args[1], V5cID: v.V5cID, Lender: caller, Amount: amount, Status: LIEN_ACTIVE, Registered: now})
+
+															if err != nil { return nil, err }
+
+	v.Financed = true
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("REGISTER_LIEN: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 release_lien - Called by the lender to release its lien on the vehicle once the finance is settled. Takes the v5cID
+//					and the lienID. The vehicle can be transferred again once every lien on it is released.
+//=================================================================================================================================
+func (t *SimpleChaincode) release_lien(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 { return nil, errors.New("RELEASE_LIEN: Incorrect number of arguments passed") }
+
+	liens, err := t.retrieve_liens(stub, v.V5cID)
+
+															if err != nil { return nil, err }
+
+	found := false
+	v.Financed = false
+
+	for _, l := range liens {
+
+		if l.LienID == args[1] {
+
+			if l.Lender != caller { return nil, errors.New(fmt.Sprintf("Permission Denied. release_lien. %v === %v", l.Lender, caller)) }
+			if l.Status != LIEN_ACTIVE { return nil, errors.New("RELEASE_LIEN: Lien " + l.LienID + " is already released") }
+
+			l.Status = LIEN_RELEASED
+			l.Released, err = t.get_tx_time(stub)
+															if err != nil { return nil, err }
+
+			err = t.save_lien(stub, l)
+															if err != nil { return nil, err }
+
+			found = true
+		}
+
+		if l.Status == LIEN_ACTIVE { v.Financed = true }
+	}
+
+	if !found { return nil, errors.New("RELEASE_LIEN: No lien " + args[1] + " on " + v.V5cID) }
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("RELEASE_LIEN: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Damage Functions
+//=================================================================================================================================
+//	 check_write_off - Returns an error if the vehicle's write-off category stops function being carried out. A vehicle in
+//					   category A or B can only be transferred to a scrap merchant.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_write_off(v Vehicle, function string) error {
+
+	if v.WriteOff != WRITE_OFF_A && v.WriteOff != WRITE_OFF_B { return nil }
+
+	if function == "private_to_scrap_merchant" { return nil }
+
+	return errors.New("Vehicle " + v.V5cID + " is a category " + v.WriteOff + " write-off and can only be scrapped")
+}
+
+//=================================================================================================================================
+//	 write_off_severity - Returns the position of the category in write_off_categories, most severe first, or -1 if it
+//						  isn't a write-off category.
+//=================================================================================================================================
+func (t *SimpleChaincode) write_off_severity(category string) int {
+
+	for i, c := range write_off_categories {
+		if c == category { return i }
+	}
+
+	return -1
+}
+
+//=================================================================================================================================
+//	 record_damage - Called by an insurer to record damage to the vehicle. Takes the v5cID, a description of the damage and
+//					 optionally a write-off category (A, B, S or N). The category can only be made more severe.
+//=================================================================================================================================
+func (t *SimpleChaincode) record_damage(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 && len(args) != 3 { return nil, errors.New("RECORD_DAMAGE: Incorrect number of arguments passed") }
+
+	if caller_affiliation != INSURER { return nil, errors.New(fmt.Sprintf("Permission Denied. record_damage. %v === %v", caller_affiliation, INSURER)) }
+
+	if args[1] == "" { return nil, errors.New("RECORD_DAMAGE: A description of the damage is required") }
+
+	if v.Scrapped { return nil, errors.New("RECORD_DAMAGE: Vehicle " + v.V5cID + " has been scrapped") }
+
+	d := Damage_Event{V5cID: v.V5cID, Description: args[1], Insurer: caller}
+
+	if len(args) == 3 && args[2] != "" {
+
+		d.Category = strings.ToUpper(args[2])
+
+		severity := t.write_off_severity(d.Category)
+
+		if severity < 0 { return nil, errors.New("RECORD_DAMAGE: Invalid write-off category " + args[2]) }
+
+		if v.WriteOff != "" && severity > t.write_off_severity(v.WriteOff) { return nil, errors.New("RECORD_DAMAGE: Vehicle " + v.V5cID + " is already a category " + v.WriteOff + " write-off") }
+
+		v.WriteOff = d.Category
+	}
+
+	var count History_Count
+
+	bytes, err := stub.GetState("damage_" + v.V5cID)
+
+															if err != nil { return nil, errors.New("RECORD_DAMAGE: Unable to get damage count for " + v.V5cID) }
+
+	if bytes != nil {
+		err = json.Unmarshal(bytes, &count)
+															if err != nil { return nil, errors.New("RECORD_DAMAGE: Corrupt damage count for " + v.V5cID) }
+	}
+
+	d.Sequence = count.Count
+
+	d.Date, err = t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	bytes, err = json.Marshal(d)
+
+															if err != nil { return nil, errors.New("RECORD_DAMAGE: Error converting damage event") }
+
+	err = stub.PutState(fmt.Sprintf("damage_%s_%08d", v.V5cID, d.Sequence), bytes)
+
+															if err != nil { return nil, errors.New("RECORD_DAMAGE: Error storing damage event") }
+
+	count.Count++
+
+	bytes, err = json.Marshal(count)
+
+															if err != nil { return nil, errors.New("RECORD_DAMAGE: Error converting damage count") }
+
+	err = stub.PutState("damage_" + v.V5cID, bytes)
+
+															if err != nil { return nil, errors.New("RECORD_DAMAGE: Error storing damage count") }
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("RECORD_DAMAGE: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Type Approval Functions
+//=================================================================================================================================
+//	 type_approval_key - Returns the key of the type approval for a manufacturer's make and model. Makes and models are
+//						 matched ignoring case.
+//=================================================================================================================================
+func (t *SimpleChaincode) type_approval_key(manufacturer string, make string, model string) string {
+
+	return "type_approval_" + manufacturer + "_" + strings.ToUpper(make) + "_" + strings.ToUpper(model)
+}
+
+//=================================================================================================================================
+//	 retrieve_type_approval - Gets the type approval stored under key. Returns false if there isn't one.
+//=================================================================================================================================
+func (t *SimpleChaincode) retrieve_type_approval(stub shim.ChaincodeStubInterface, key string) (Type_Approval, bool, error) {
+
+	var a Type_Approval
+
+	bytes, err := stub.GetState(key)
+
+															if err != nil { return a, false, errors.New("Unable to get type approval " + key) }
+
+	if bytes == nil { return a, false, nil }
+
+	err = json.Unmarshal(bytes, &a)
+
+															if err != nil { return a, false, errors.New("Corrupt type approval record " + string(bytes)) }
+
+	return a, true, nil
+}
+
+//=================================================================================================================================
+//	 save_type_approval - Writes a type approval to the ledger.
+//=================================================================================================================================
+func (t *SimpleChaincode) save_type_approval(stub shim.ChaincodeStubInterface, a Type_Approval) error {
+
+	bytes, err := json.Marshal(a)
+
+															if err != nil { return errors.New("Error converting type approval") }
+
+	err = stub.PutState(t.type_approval_key(a.Manufacturer, a.Make, a.Model), bytes)
+
+															if err != nil { return errors.New("Error storing type approval") }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 check_type_approval - Returns the type approval in force for the vehicle's owner to build its make and model, or an
+//						   error if there isn't one.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_type_approval(stub shim.ChaincodeStubInterface, v Vehicle) (Type_Approval, error) {
+
+	a, found, err := t.retrieve_type_approval(stub, t.type_approval_key(v.Owner, v.Make, v.Model))
+
+															if err != nil { return a, err }
+
+	if !found || a.Status != APPROVAL_APPROVED { return a, errors.New("No type approval for " + v.Owner + " to build " + v.Make + " " + v.Model) }
+
+	return a, nil
+}
+
+//=================================================================================================================================
+//	 make_approved - Returns true if the manufacturer has a type approval in force for any model of the make.
+//=================================================================================================================================
+func (t *SimpleChaincode) make_approved(stub shim.ChaincodeStubInterface, manufacturer string, make string) (bool, error) {
+
+	prefix := "type_approval_" + manufacturer + "_" + strings.ToUpper(make) + "_"
+
+	_, values, _, err := t.read_range(stub, prefix, prefix + "~", "", 0)
+
+															if err != nil { return false, err }
+
+	for _, value := range values {
+
+		var a Type_Approval
+
+		err = json.Unmarshal(value, &a)
+
+															if err != nil { return false, errors.New("Corrupt type approval record " + string(value)) }
+
+		if a.Status == APPROVAL_APPROVED && a.Manufacturer == manufacturer && strings.ToUpper(a.Make) == strings.ToUpper(make) { return true, nil }
+	}
+
+	return false, nil
+}
+
+//=================================================================================================================================
+//	 approve_type - Called by the regulator to approve a make and model for a manufacturer. Takes the manufacturer, the
+//					make, the model and the approval number, which must not have been used before. A withdrawn approval
+//					can be replaced with a new one.
+//=================================================================================================================================
+func (t *SimpleChaincode) approve_type(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 4 || args[1] == "" || args[2] == "" || args[3] == "" { return nil, errors.New("APPROVE_TYPE: Incorrect number of arguments passed") }
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. approve_type. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	p, err := t.retrieve_participant(stub, args[0])
+
+															if err != nil { return nil, err }
+															if p.Role != MANUFACTURER { return nil, errors.New("APPROVE_TYPE: " + args[0] + " is not a manufacturer") }
+
+	number, err := stub.GetState("approval_number_" + args[3])
+
+															if err != nil { return nil, errors.New("APPROVE_TYPE: Unable to get approval number index") }
+															if number != nil { return nil, errors.New("APPROVE_TYPE: Approval number " + args[3] + " has already been issued") }
+
+	key := t.type_approval_key(args[0], args[1], args[2])
+
+	existing, found, err := t.retrieve_type_approval(stub, key)
+
+															if err != nil { return nil, err }
+															if found && existing.Status == APPROVAL_APPROVED { return nil, errors.New("APPROVE_TYPE: " + args[1] + " " + args[2] + " is already approved for " + args[0] + " as " + existing.ApprovalNumber) }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	a := Type_Approval{ApprovalNumber: args[3], Manufacturer: args[0], Make: args[1], Model: args[2], Status: APPROVAL_APPROVED, Approved: now}
+
+	err = t.save_type_approval(stub, a)
+
+															if err != nil { return nil, err }
+
+	err = stub.PutState("approval_number_" + a.ApprovalNumber, []byte(key))
+
+															if err != nil { return nil, errors.New("APPROVE_TYPE: Error storing approval number index") }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 withdraw_type_approval - Called by the regulator to withdraw a type approval. Takes the approval number. Vehicles
+//							  already built keep their make and model but no more can be given it or sold new.
+//=================================================================================================================================
+func (t *SimpleChaincode) withdraw_type_approval(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 1 { return nil, errors.New("WITHDRAW_TYPE_APPROVAL: Incorrect number of arguments passed") }
+
+	if caller_affiliation != AUTHORITY { return nil, errors.New(fmt.Sprintf("Permission Denied. withdraw_type_approval. %v === %v", caller_affiliation, AUTHORITY)) }
+
+	key, err := stub.GetState("approval_number_" + args[0])
+
+															if err != nil { return nil, errors.New("WITHDRAW_TYPE_APPROVAL: Unable to get approval number index") }
+															if key == nil { return nil, errors.New("WITHDRAW_TYPE_APPROVAL: No type approval " + args[0]) }
+
+	a, found, err := t.retrieve_type_approval(stub, string(key))
+
+															if err != nil { return nil, err }
+
+	if !found || a.ApprovalNumber != args[0] || a.Status != APPROVAL_APPROVED { return nil, errors.New("WITHDRAW_TYPE_APPROVAL: Type approval " + args[0] + " is not in force") }
+
+	a.Status = APPROVAL_WITHDRAWN
+
+	a.Withdrawn, err = t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	err = t.save_type_approval(stub, a)
+
+															if err != nil { return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Plate Functions
+//=================================================================================================================================
+//	 normalise_registration - Returns the registration in upper case without spaces, the form plates are stored in.
+//=================================================================================================================================
+func (t *SimpleChaincode) normalise_registration(reg string) string {
+
+	return strings.ToUpper(strings.Replace(reg, " ", "", -1))
+}
+
+//=================================================================================================================================
+//	 retrieve_plate - Gets the plate for a registration. The plates are the only record of which registrations have been
+//					  issued. Returns a plate with no status if it has never been issued.
+//=================================================================================================================================
+func (t *SimpleChaincode) retrieve_plate(stub shim.ChaincodeStubInterface, reg string) (Plate, error) {
+
+	p := Plate{Registration: reg}
+
+	bytes, err := stub.GetState("plate_" + reg)
+
+															if err != nil { return p, errors.New("Unable to get plate " + reg) }
+
+	if bytes != nil {
+
+		err = json.Unmarshal(bytes, &p)
+
+															if err != nil { return p, errors.New("Corrupt plate record " + string(bytes)) }
+	}
+
+	return p, nil
+}
+
+//=================================================================================================================================
+//	 record_plate - Called whenever a vehicle is saved. Checks that the vehicle's registration is on a plate assigned to
+//					it. A registration given before plates were recorded, e.g. to a vehicle moved by migrate_index, gets
+//					its plate now if no other vehicle has taken it.
+//=================================================================================================================================
+func (t *SimpleChaincode) record_plate(stub shim.ChaincodeStubInterface, v Vehicle) error {
+
+	if t.plate_key(v) == "" { return nil }
+
+	reg := t.normalise_registration(v.Reg)
+
+	p, err := t.retrieve_plate(stub, reg)
+
+															if err != nil { return err }
+
+	if p.Status == PLATE_ASSIGNED && p.V5cID == v.V5cID { return nil }
+
+	if p.Status != "" { return errors.New("Registration " + reg + " already registered to another vehicle") }
+
+	return t.save_plate(stub, Plate{Registration: reg, Status: PLATE_ASSIGNED, V5cID: v.V5cID})
+}
+
+//=================================================================================================================================
+//	 save_plate - Writes a plate to the ledger.
+//=================================================================================================================================
+func (t *SimpleChaincode) save_plate(stub shim.ChaincodeStubInterface, p Plate) error {
+
+	bytes, err := json.Marshal(p)
+
+															if err != nil { return errors.New("Error converting plate") }
+
+	err = stub.PutState("plate_" + p.Registration, bytes)
+
+															if err != nil { return errors.New("Error storing plate") }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 remove_plate - Deletes the record of the plate on the vehicle, if it has one.
+//=================================================================================================================================
+func (t *SimpleChaincode) remove_plate(stub shim.ChaincodeStubInterface, v Vehicle) error {
+
+	if t.plate_key(v) == "" { return nil }
+
+	err := stub.DelState(t.plate_key(v))
+
+															if err != nil { return errors.New("Unable to remove plate " + v.Reg) }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 retain_on_certificate - Takes the plate off the vehicle and puts it on a retention certificate for holder. Returns the
+//							 vehicle with no registration, doesn't save it.
+//=================================================================================================================================
+func (t *SimpleChaincode) retain_on_certificate(stub shim.ChaincodeStubInterface, v Vehicle, holder string) (Vehicle, error) {
+
+	reg := t.normalise_registration(v.Reg)
+
+	if t.plate_key(v) == "" { return v, errors.New("Vehicle " + v.V5cID + " has no plate") }
+
+	err := stub.DelState(t.plate_key(v))
+
+															if err != nil { return v, errors.New("Unable to remove plate " + v.Reg) }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return v, err }
+
+	c := Retention_Certificate{CertificateID: t.document_ref(stub, reg), Holder: holder, Issued: now, Expiry: now + RETENTION_YEARS * SECONDS_PER_YEAR}
+
+	err = t.save_plate(stub, Plate{Registration: reg, Status: PLATE_RETAINED, Certificate: &c})
+
+															if err != nil { return v, err }
+
+	v.Reg = "UNDEFINED"
+
+	return v, nil
+}
+
+//=================================================================================================================================
+//	 retain_plate - Called by the owner to take the plate off the vehicle, e.g. before selling it. The plate is held on a
+//					retention certificate for the owner and the vehicle is left without a registration until the owner
+//					registers it again.
+//=================================================================================================================================
+func (t *SimpleChaincode) retain_plate(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+
+	if v.Owner != caller || v.Scrapped { return nil, errors.New(fmt.Sprintf("Permission Denied. retain_plate. %v === %v, %v", v.Owner, caller, v.Scrapped)) }
+
+	err := t.check_not_stolen(v)
+
+															if err != nil { return nil, err }
+
+	v, err = t.retain_on_certificate(stub, v, caller)
+
+															if err != nil { return nil, errors.New("RETAIN_PLATE: " + err.Error()) }
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("RETAIN_PLATE: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 check_plate_vehicle - Returns an error unless the caller owns the vehicle and its plate can be changed.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_plate_vehicle(v Vehicle, caller string) error {
+
+	if v.Owner != caller || v.Scrapped { return errors.New(fmt.Sprintf("Permission Denied. transfer_plate. %v === %v, %v", v.Owner, caller, v.Scrapped)) }
+
+	err := t.check_not_frozen(v)
+
+															if err != nil { return err }
+
+	return t.check_not_stolen(v)
+}
+
+//=================================================================================================================================
+//	 transfer_plate - Moves a plate onto a vehicle the caller owns. Takes the registration and the v5cID of the vehicle.
+//					  The plate comes off another vehicle the caller owns, which is left without a registration, or off
+//					  a retention certificate the caller holds. A plate already on the vehicle is put on a retention
+//					  certificate for the caller. All the changes are made together or not at all.
+//=================================================================================================================================
+func (t *SimpleChaincode) transfer_plate(stub shim.ChaincodeStubInterface, event *Vehicle_Event, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 { return nil, errors.New("TRANSFER_PLATE: Incorrect number of arguments passed") }
+
+	reg := t.normalise_registration(args[0])
+
+	p, err := t.retrieve_plate(stub, reg)
+
+															if err != nil { return nil, err }
+
+	to, err := t.retrieve_v5c(stub, args[1])
+
+															if err != nil { return nil, err }
+
+	to, err = t.check_lease_expiry(stub, event, to, caller)
+
+															if err != nil { return nil, err }
+
+	err = t.check_plate_vehicle(to, caller)
+
+															if err != nil { return nil, err }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	var changed []Vehicle										// The vehicles changed, as they were, for their history
+
+	if p.Status == PLATE_ASSIGNED {
+
+		if p.V5cID == to.V5cID { return nil, errors.New("TRANSFER_PLATE: " + reg + " is already on " + to.V5cID) }
+
+		from, err := t.retrieve_v5c(stub, p.V5cID)
+															if err != nil { return nil, err }
+
+		from, err = t.check_lease_expiry(stub, event, from, caller)
+															if err != nil { return nil, err }
+
+		err = t.check_plate_vehicle(from, caller)
+															if err != nil { return nil, err }
+
+		changed = append(changed, from)
+
+		from.Reg = "UNDEFINED"
+
+		_, err = t.save_changes(stub, from)					// The plate leaves the index before it's put on the new vehicle
+															if err != nil { return nil, err }
+
+	} else if p.Status == PLATE_RETAINED {
+
+		if p.Certificate.Holder != caller { return nil, errors.New(fmt.Sprintf("Permission Denied. transfer_plate. %v === %v", p.Certificate.Holder, caller)) }
+		if p.Certificate.Expiry <= now { return nil, errors.New("TRANSFER_PLATE: Retention certificate for " + reg + " has expired") }
+
+	} else {
+		return nil, errors.New("TRANSFER_PLATE: Registration " + reg + " has not been issued")
+	}
+
+	changed = append(changed, to)
+
+	if t.plate_key(to) != "" {
+
+		to, err = t.retain_on_certificate(stub, to, caller)
+															if err != nil { return nil, errors.New("TRANSFER_PLATE: " + err.Error()) }
+	}
+
+	to.Reg = reg
+
+	err = t.save_plate(stub, Plate{Registration: reg, Status: PLATE_ASSIGNED, V5cID: to.V5cID})
+
+															if err != nil { return nil, err }
+
+	_, err = t.save_changes(stub, to)
+
+															if err != nil { fmt.Printf("TRANSFER_PLATE: Error saving changes: %s", err); return nil, err }
+
+	for _, previous := range changed {
+
+		err = t.record_history(stub, event, previous, "transfer_plate", caller)
+
+															if err != nil { fmt.Printf("TRANSFER_PLATE: Error recording history: %s", err); return nil, errors.New("Error recording history") }
+	}
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Tax Functions
+//=================================================================================================================================
+//	 tax_status - Returns whether the vehicle is taxed, SORN or untaxed at the time now.
+//=================================================================================================================================
+func (t *SimpleChaincode) tax_status(v Vehicle, now int64) string {
+
+	if v.TaxStatus == TAX_SORN { return TAX_SORN }
+
+	if v.TaxStatus == TAX_TAXED && v.TaxedUntil > now { return TAX_TAXED }
+
+	return TAX_UNTAXED
+}
+
+//=================================================================================================================================
+//	 on_the_road - Returns whether the vehicle has left the manufacturer and not gone for scrap, so needs taxing or SORN.
+//=================================================================================================================================
+func (t *SimpleChaincode) on_the_road(v Vehicle) bool {
+
+	return v.Status == STATE_PRIVATE_OWNERSHIP || v.Status == STATE_LEASED_OUT || v.Status == STATE_LEASE_OWNERSHIP
+}
+
+//=================================================================================================================================
+//	 check_tax_keeper - Returns an error unless the caller is the owner or the keeper of a vehicle that is on the road.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_tax_keeper(v Vehicle, caller string, function string) error {
+
+	if 		(v.Owner != caller && v.Keeper != caller)	||
+			v.Scrapped									||
+			!t.on_the_road(v)							{
+
+		return errors.New(fmt.Sprintf("Permission Denied. %s. %v, %v === %v, %v", function, v.Owner, v.Keeper, caller, v.Status))
+	}
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 tax_vehicle - Called by the owner or keeper to tax the vehicle. Takes the v5cID and the number of months, up to
+//				   MAX_TAX_MONTHS. Tax that hasn't run out is extended, otherwise the tax starts now and any SORN ends. The
+//				   vehicle must have a valid inspection if it is old enough to need one and mustn't be a category A or B
+//				   write-off.
+//=================================================================================================================================
+func (t *SimpleChaincode) tax_vehicle(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 { return nil, errors.New("TAX_VEHICLE: Incorrect number of arguments passed") }
+
+	months, err := strconv.Atoi(args[1])
+
+															if err != nil || months < 1 || months > MAX_TAX_MONTHS { return nil, errors.New("TAX_VEHICLE: Invalid number of months " + args[1]) }
+
+	err = t.check_tax_keeper(v, caller, "tax_vehicle")
+
+															if err != nil { return nil, err }
+
+	err = t.check_write_off(v, "tax_vehicle")
+
+															if err != nil { return nil, errors.New("TAX_VEHICLE: " + err.Error()) }
+
+	err = t.check_inspection(stub, v)
+
+															if err != nil { return nil, errors.New("TAX_VEHICLE: " + err.Error()) }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	start := now
+
+	if t.tax_status(v, now) == TAX_TAXED { start = v.TaxedUntil }
+
+	v.TaxStatus  = TAX_TAXED
+	v.TaxedUntil = time.Unix(start, 0).UTC().AddDate(0, months, 0).Unix()
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("TAX_VEHICLE: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 declare_sorn - Called by the owner or keeper to declare the vehicle off the road. Any tax it has ends.
+//=================================================================================================================================
+func (t *SimpleChaincode) declare_sorn(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+
+	err := t.check_tax_keeper(v, caller, "declare_sorn")
+
+															if err != nil { return nil, err }
+
+	if v.TaxStatus == TAX_SORN { return nil, errors.New("DECLARE_SORN: Vehicle " + v.V5cID + " is already declared off the road") }
+
+	v.TaxStatus  = TAX_SORN
+	v.TaxedUntil = 0
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("DECLARE_SORN: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Keeper Functions
+//=================================================================================================================================
+//	 assign_keeper - Called by the owner to make another participant the registered keeper of the vehicle. Takes the
+//					 keeper and the v5cID. The keeper can read the vehicle but doesn't own it. A leased out vehicle is
+//					 kept by the lessee until the lease ends.
+//=================================================================================================================================
+func (t *SimpleChaincode) assign_keeper(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, keeper string) ([]byte, error) {
+
+	if 		v.Owner				!= caller			||
+			v.Status			== STATE_LEASED_OUT	||
+			v.Scrapped			!= false			{
+
+		return nil, errors.New(fmt.Sprintf("Permission Denied. assign_keeper. %v === %v, %v, %v", v.Owner, caller, v.Status, v.Scrapped))
+	}
+
+	if keeper == caller { return nil, errors.New("ASSIGN_KEEPER: The owner keeps the vehicle when it has no keeper") }
+
+	p, err := t.retrieve_participant(stub, keeper)
+
+															if err != nil { return nil, errors.New("ASSIGN_KEEPER: Unknown keeper " + keeper) }
+
+	if p.Status != PARTICIPANT_ACTIVE { return nil, errors.New("ASSIGN_KEEPER: Keeper " + keeper + " is " + p.Status) }
+
+	v.Keeper = keeper
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("ASSIGN_KEEPER: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 release_keeper - Ends the keeper's rights to the vehicle, which is kept by its owner again. Takes the v5cID. Can be
+//					  called by the owner or by the keeper handing the vehicle back. A leased out vehicle is released by
+//					  ending the lease.
+//=================================================================================================================================
+func (t *SimpleChaincode) release_keeper(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+
+	if v.Keeper == "" { return nil, errors.New("RELEASE_KEEPER: Vehicle " + v.V5cID + " has no keeper") }
+
+	if 		(v.Owner != caller && v.Keeper != caller)	||
+			v.Status			== STATE_LEASED_OUT		{
+
+		return nil, errors.New(fmt.Sprintf("Permission Denied. release_keeper. %v, %v === %v, %v", v.Owner, v.Keeper, caller, v.Status))
+	}
+
+	v.Keeper = ""
+
+	_, err := t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("RELEASE_KEEPER: Error saving changes: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Lease Functions
+//=================================================================================================================================
+//	 retrieve_lease - Gets the lease contract stored at lease_<leaseID> in the ledger.
+//=================================================================================================================================
+func (t *SimpleChaincode) retrieve_lease(stub shim.ChaincodeStubInterface, leaseID string) (Lease_Contract, error) {
+
+	var l Lease_Contract
+
+	bytes, err := stub.GetState("lease_" + leaseID)
+
+															if err != nil { return l, errors.New("RETRIEVE_LEASE: Error retrieving lease with leaseID = " + leaseID) }
+															if bytes == nil { return l, errors.New("RETRIEVE_LEASE: No lease with leaseID = " + leaseID) }
+
+	err = json.Unmarshal(bytes, &l)
+
+															if err != nil { return l, errors.New("RETRIEVE_LEASE: Corrupt lease record " + string(bytes)) }
+
+	return l, nil
+}
+
+//=================================================================================================================================
+//	 save_lease - Writes the lease contract to the ledger under lease_<leaseID>.
+//=================================================================================================================================
+func (t *SimpleChaincode) save_lease(stub shim.ChaincodeStubInterface, l Lease_Contract) error {
+
+	bytes, err := json.Marshal(l)
+
+															if err != nil { return errors.New("Error converting lease record") }
+
+	err = stub.PutState("lease_" + l.LeaseID, bytes)
+
+															if err != nil { return errors.New("Error storing lease record") }
+
+	return nil
+}
+
+//=================================================================================================================================
+//	 end_lease - Takes the vehicle of a lease out of STATE_LEASED_OUT, back into STATE_LEASE_OWNERSHIP with the lessor, and
+//				 records the change in the vehicle's history.
+//=================================================================================================================================
+func (t *SimpleChaincode) end_lease(stub shim.ChaincodeStubInterface, event *Vehicle_Event, l Lease_Contract, function string, caller string) error {
+
+	v, err := t.retrieve_v5c(stub, l.V5cID)
+
+															if err != nil { return err }
+
+	if v.LeaseContractID != l.LeaseID { return nil }			// The vehicle is no longer on this lease so there is nothing to undo
+
+	previous := v
+
+	v.Status          = STATE_LEASE_OWNERSHIP
+	v.LeaseContractID = "UNDEFINED"
+	v.Keeper          = ""
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { return err }
+
+	return t.record_history(stub, event, previous, function, caller)
+}
+
+//=================================================================================================================================
+//	 check_lease_expiry - Called whenever a vehicle is touched. If the vehicle is leased out on a lease whose end date has
+//						  passed the lease is marked expired and the vehicle returned to its owner. Returns the vehicle as
+//						  it now is.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_lease_expiry(stub shim.ChaincodeStubInterface, event *Vehicle_Event, v Vehicle, caller string) (Vehicle, error) {
+
+	if v.Status != STATE_LEASED_OUT || v.LeaseContractID == "UNDEFINED" { return v, nil }
+
+	l, err := t.retrieve_lease(stub, v.LeaseContractID)
+
+															if err != nil { return v, err }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return v, err }
+
+	if l.Status != LEASE_ACTIVE || now <= l.EndDate { return v, nil }
+
+	l.Status = LEASE_EXPIRED
+
+	err = t.save_lease(stub, l)
+
+															if err != nil { return v, err }
+
+	err = t.end_lease(stub, event, l, "lease_expired", caller)
+
+															if err != nil { return v, err }
+
+	return t.retrieve_v5c(stub, v.V5cID)
+}
+
+//=================================================================================================================================
+//	 create_lease - Creates a pending lease of a vehicle owned by the calling lease company. Takes the leaseID, v5cID,
+//					lessee, start and end dates, monthly payment and mileage allowance.
+//=================================================================================================================================
+func (t *SimpleChaincode) create_lease(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 7 { return nil, errors.New("CREATE_LEASE: Incorrect number of arguments passed") }
+
+	var l Lease_Contract
+	var err error
+
+	l.LeaseID = args[0]
+	l.V5cID   = args[1]
+	l.Lessee  = args[2]
+	l.Lessor  = caller
+	l.Status  = LEASE_PENDING
+
+	l.StartDate, err = strconv.ParseInt(args[3], 10, 64)
+															if err != nil { return nil, errors.New("CREATE_LEASE: Invalid start date " + args[3]) }
+	l.EndDate, err = strconv.ParseInt(args[4], 10, 64)
+															if err != nil { return nil, errors.New("CREATE_LEASE: Invalid end date " + args[4]) }
+	l.MonthlyPayment, err = strconv.Atoi(args[5])
+															if err != nil || l.MonthlyPayment < 0 { return nil, errors.New("CREATE_LEASE: Invalid monthly payment " + args[5]) }
+	l.MileageAllowance, err = strconv.Atoi(args[6])
+															if err != nil || l.MileageAllowance < 0 { return nil, errors.New("CREATE_LEASE: Invalid mileage allowance " + args[6]) }
+
+	if l.LeaseID == "" || l.Lessee == "" || l.Lessee == caller { return nil, errors.New("CREATE_LEASE: Invalid leaseID or lessee") }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	if l.EndDate <= l.StartDate || l.EndDate <= now { return nil, errors.New("CREATE_LEASE: Lease must end after it starts and in the future") }
+
+	record, err := stub.GetState("lease_" + l.LeaseID)
+
+															if err != nil { return nil, errors.New("CREATE_LEASE: Unable to look up lease " + l.LeaseID + ": " + err.Error()) }
+															if record != nil { return nil, errors.New("CREATE_LEASE: Lease already exists") }
+
+	v, err := t.retrieve_v5c(stub, l.V5cID)
+
+															if err != nil { return nil, err }
+
+	if 		v.Status			!= STATE_LEASE_OWNERSHIP	||
+			v.Owner				!= caller					||
+			caller_affiliation	!= LEASE_COMPANY			||
+			v.Scrapped			!= false					{
+
+		return nil, errors.New(fmt.Sprintf("Permission Denied. create_lease. %v === %v, %v === %v, %v === %v, %v === %v", v.Status, STATE_LEASE_OWNERSHIP, v.Owner, caller, caller_affiliation, LEASE_COMPANY, v.Scrapped, false))
+	}
+
+	err = t.save_lease(stub, l)
+
+															if err != nil { fmt.Printf("CREATE_LEASE: Error saving lease: %s", err); return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 activate_lease - Called by the lessee to accept a pending lease. The vehicle is leased out under the lease.
+//=================================================================================================================================
+func (t *SimpleChaincode) activate_lease(stub shim.ChaincodeStubInterface, event *Vehicle_Event, l Lease_Contract, caller string, caller_affiliation string) ([]byte, error) {
+
+	v, err := t.retrieve_v5c(stub, l.V5cID)
+
+															if err != nil { return nil, err }
+
+	v, err = t.check_lease_expiry(stub, event, v, caller)
+
+															if err != nil { return nil, err }
+
+	err = t.check_not_stolen(v)
+
+															if err != nil { return nil, err }
+
+	err = t.check_write_off(v, "activate_lease")
+
+															if err != nil { return nil, err }
+
+	now, err := t.get_tx_time(stub)
+
+															if err != nil { return nil, err }
+
+	if 		l.Status			== LEASE_PENDING			&&
+			l.Lessee			== caller					&&
+			now					<  l.EndDate				&&
+			v.Status			== STATE_LEASE_OWNERSHIP	&&
+			v.Owner				== l.Lessor					&&
+			v.LeaseContractID	== "UNDEFINED"				&&
+			v.Scrapped			== false					{
+
+					l.Status = LEASE_ACTIVE
+
+	} else {
+		return nil, errors.New(fmt.Sprintf("Permission Denied. activate_lease. %v === %v, %v === %v, %v === %v, %v === %v, %v === %v", l.Status, LEASE_PENDING, l.Lessee, caller, v.Status, STATE_LEASE_OWNERSHIP, v.Owner, l.Lessor, v.LeaseContractID, "UNDEFINED"))
+	}
+
+	previous := v
+
+	v.Status          = STATE_LEASED_OUT
+	v.LeaseContractID = l.LeaseID
+	v.Keeper          = l.Lessee
+
+	_, err = t.save_changes(stub, v)
+
+															if err != nil { fmt.Printf("ACTIVATE_LEASE: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+
+	err = t.save_lease(stub, l)
+
+															if err != nil { return nil, err }
+
+	err = t.record_history(stub, event, previous, "activate_lease", caller)
+
+															if err != nil { return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 record_lease_payment - Called by the lessor to record a payment received under an active lease. Takes the leaseID
+//							and the amount paid.
+//=================================================================================================================================
+func (t *SimpleChaincode) record_lease_payment(stub shim.ChaincodeStubInterface, event *Vehicle_Event, l Lease_Contract, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) != 2 { return nil, errors.New("RECORD_LEASE_PAYMENT: Incorrect number of arguments passed") }
+
+	amount, err := strconv.Atoi(args[1])
+
+															if err != nil || amount <= 0 { return nil, errors.New("RECORD_LEASE_PAYMENT: Invalid amount " + args[1]) }
+
+	v, err := t.retrieve_v5c(stub, l.V5cID)
+
+															if err != nil { return nil, err }
+
+	_, err = t.check_lease_expiry(stub, event, v, caller)
+
+															if err != nil { return nil, err }
+
+	l, err = t.retrieve_lease(stub, l.LeaseID)						// The expiry check may have changed the lease
+
+															if err != nil { return nil, err }
+
+	if 		l.Status	== LEASE_ACTIVE	&&
+			l.Lessor	== caller		{
+
+					l.PaymentsMade++
+					l.AmountPaid += amount
+	} else {
+		return nil, errors.New(fmt.Sprintf("Permission Denied. record_lease_payment. %v === %v, %v === %v", l.Status, LEASE_ACTIVE, l.Lessor, caller))
+	}
+
+	err = t.save_lease(stub, l)
+
+															if err != nil { return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 terminate_lease - Called by the lessor to end a pending or active lease early. An active lease returns the vehicle
+//					   to the lessor.
+//=================================================================================================================================
+func (t *SimpleChaincode) terminate_lease(stub shim.ChaincodeStubInterface, event *Vehicle_Event, l Lease_Contract, caller string, caller_affiliation string) ([]byte, error) {
+
+	if 		(l.Status	== LEASE_PENDING	||
+			 l.Status	== LEASE_ACTIVE)	&&
+			 l.Lessor	== caller			{
+
+					l.Status = LEASE_TERMINATED
+	} else {
+		return nil, errors.New(fmt.Sprintf("Permission Denied. terminate_lease. %v, %v === %v", l.Status, l.Lessor, caller))
+	}
+
+	err := t.save_lease(stub, l)
+
+															if err != nil { return nil, err }
+
+	err = t.end_lease(stub, event, l, "terminate_lease", caller)
+
+															if err != nil { return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 return_leased_vehicle - Called by the lessee or lessor when the vehicle is handed back at the end of an active lease.
+//							 Takes the leaseID and optionally the mileage covered during the lease.
+//=================================================================================================================================
+func (t *SimpleChaincode) return_leased_vehicle(stub shim.ChaincodeStubInterface, event *Vehicle_Event, l Lease_Contract, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if len(args) > 1 {
+
+		mileage, err := strconv.Atoi(args[1])
+
+															if err != nil || mileage < 0 { return nil, errors.New("RETURN_LEASED_VEHICLE: Invalid mileage " + args[1]) }
+
+		l.ReturnMileage = mileage
+	}
+
+	if 		(l.Status	== LEASE_ACTIVE		||
+			 l.Status	== LEASE_EXPIRED)	&&
+			(l.Lessee	== caller			||
+			 l.Lessor	== caller)			{
+
+					l.Status = LEASE_RETURNED
+	} else {
+		return nil, errors.New(fmt.Sprintf("Permission Denied. return_leased_vehicle. %v, %v %v === %v", l.Status, l.Lessee, l.Lessor, caller))
+	}
+
+	err := t.save_lease(stub, l)
+
+															if err != nil { return nil, err }
+
+	err = t.end_lease(stub, event, l, "return_leased_vehicle", caller)
+
+															if err != nil { return nil, err }
+
+	return nil, nil
+}
+
+//=================================================================================================================================
+//	 Read Functions
+//=================================================================================================================================
+//	 get_vehicle_details
+//=================================================================================================================================
+func (t *SimpleChaincode) get_vehicle_details(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+
+	now, err := t.get_tx_time(stub)
+
+																if err != nil { return nil, err }
+
+	v.TaxStatus = t.tax_status(v, now)							// Tax that has run out is shown as untaxed
+
+	bytes, err := json.Marshal(v)
+
+																if err != nil { return nil, errors.New("GET_VEHICLE_DETAILS: Invalid vehicle object") }
+
+	if 		t.can_read_vehicle(v, caller, caller_affiliation) {
+
+					return bytes, nil
+	} else {
+																return nil, errors.New("Permission Denied. get_vehicle_details")
+	}
+
+}
+
+//=================================================================================================================================
+//	 can_read_vehicle - The owner of a vehicle, its keeper and the regulator may read its details and history.
+//=================================================================================================================================
+func (t *SimpleChaincode) can_read_vehicle(v Vehicle, caller string, caller_affiliation string) bool {
+
+	return 	v.Owner				== caller		||
+			(v.Keeper != "" && v.Keeper == caller)	||
+			caller_affiliation	== AUTHORITY
+}
+
+//=================================================================================================================================
+//	 get_vehicle_history - Returns a page of the history of a vehicle, oldest change first. Takes the v5cID and optionally
+//						   the page size and the bookmark returned with the previous page.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_vehicle_history(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	if !t.can_read_vehicle(v, caller, caller_affiliation) { return nil, errors.New("Permission Denied. get_vehicle_history") }
+
+	page_size, bookmark, err := t.parse_page_args(args, 1)
+
+																if err != nil { return nil, err }
+
+	prefix := "history_" + v.V5cID + "_"
+
+	_, values, next, err := t.read_range(stub, prefix, prefix + "~", bookmark, page_size)
+
+																if err != nil { return nil, err }
+
+	page := History_Page{V5cID: v.V5cID, Entries: []History_Entry{}, Next: next}
+
+	for _, value := range values {
+
+		var entry History_Entry
+
+		err = json.Unmarshal(value, &entry)
+
+																if err != nil { return nil, errors.New("GET_VEHICLE_HISTORY: Corrupt history entry " + string(value)) }
+
+		page.Entries = append(page.Entries, entry)
+	}
+
+	bytes, err := json.Marshal(page)
+
+																if err != nil { return nil, errors.New("GET_VEHICLE_HISTORY: Error converting history") }
+
+	return bytes, nil
+}
+
+//=================================================================================================================================
+//	 get_pending_offers - Returns the offers addressed to the caller that haven't expired.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_pending_offers(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	prefix := "offerto_" + caller + "_"
+
+	_, values, _, err := t.read_range(stub, prefix, prefix + "~", "", 0)
+
+																if err != nil { return nil, err }
+
+	offers := []Transfer_Offer{}
+
+	for _, value := range values {
+
+		o, pending, err := t.retrieve_offer(stub, string(value))
+
+																if err != nil { return nil, err }
+
+		if pending && o.Recipient == caller {					// Another recipient's identity may start with the caller's identity
+			offers = append(offers, o)
+		}
+	}
+
+	bytes, err := json.Marshal(offers)
+
+																if err != nil { return nil, errors.New("GET_PENDING_OFFERS: Error converting offers") }
+
+	return bytes, nil
+}
+
+//=================================================================================================================================
+//	 get_participants - Returns the participants in the registry. Takes an optional role and an optional type, when given
+//						only participants with that role and type are returned. Only the regulator sees the whole record,
+//						anyone else sees the name and role along with the identity and type needed to address a transfer.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_participants(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	role, participant_type := "", ""
+
+	if len(args) > 0 { role = args[0] }
+	if len(args) > 1 { participant_type = args[1] }
+
+	_, values, _, err := t.read_range(stub, "participant_", "participant_~", "", 0)
 
-	err = stub.PutState(v.V5cID, bytes)
+																if err != nil { return nil, err }
 
-	if err != nil { fmt.Printf("SAVE_CHANGES: Error storing vehicle record: %s", err); return false, errors.New("Error storing vehicle record") }
+	participants := []Participant{}
 
-	return true, nil
-}
+	for _, value := range values {
 
-//==============================================================================================================================
-//	 Router Functions
-//==============================================================================================================================
-//	Invoke - Called on chaincode invoke. Takes a function name passed and calls that function. Converts some
-//		  initial arguments passed to other things for use in the called function e.g. name -> ecert
-//==============================================================================================================================
-func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+		var p Participant
 
-	caller, caller_affiliation, err := t.get_caller_data(stub)
+		err = json.Unmarshal(value, &p)
 
-	if err != nil { return nil, errors.New("Error retrieving caller information")}
+																if err != nil { return nil, errors.New("GET_PARTICIPANTS: Corrupt participant record " + string(value)) }
 
+		if (role != "" && p.Role != role) || (participant_type != "" && p.Type != participant_type) { continue }
 
-	if function == "create_vehicle" {
-        return t.create_vehicle(stub, caller, caller_affiliation, args[0])
-	} else if function == "ping" {
-        return t.ping(stub)
-    } else { 																				// If the function is not a create then there must be a car so we need to retrieve the car.
-		argPos := 1
+		if caller_affiliation != AUTHORITY { p = Participant{Identity: p.Identity, Role: p.Role, Type: p.Type, Name: p.Name} }
 
-		if function == "scrap_vehicle" {																// If its a scrap vehicle then only two arguments are passed (no update value) all others have three arguments and the v5cID is expected in the last argument
-			argPos = 0
-		}
+		participants = append(participants, p)
+	}
 
-		v, err := t.retrieve_v5c(stub, args[argPos])
+	bytes, err := json.Marshal(participants)
 
-        if err != nil { fmt.Printf("INVOKE: Error retrieving v5c: %s", err); return nil, errors.New("Error retrieving v5c") }
+																if err != nil { return nil, errors.New("GET_PARTICIPANTS: Error converting participants") }
 
+	return bytes, nil
+}
 
-        if strings.Contains(function, "update") == false && function != "scrap_vehicle"    { 									// If the function is not an update or a scrappage it must be a transfer so we need to get the ecert of the recipient.
+//=================================================================================================================================
+//	 get_lifecycle - Returns the lifecycle table and the names of the statuses.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_lifecycle(stub shim.ChaincodeStubInterface) ([]byte, error) {
 
+	bytes, err := json.Marshal(Lifecycle{States: state_names, Transitions: lifecycle})
 
-				if 		   function == "authority_to_manufacturer" { return t.authority_to_manufacturer(stub, v, caller, caller_affiliation, args[0], "manufacturer")
-				} else if  function == "manufacturer_to_private"   { return t.manufacturer_to_private(stub, v, caller, caller_affiliation, args[0], "private")
-				} else if  function == "private_to_private" 	   { return t.private_to_private(stub, v, caller, caller_affiliation, args[0], "private")
-				} else if  function == "private_to_lease_company"  { return t.private_to_lease_company(stub, v, caller, caller_affiliation, args[0], "lease_company")
-				} else if  function == "lease_company_to_private"  { return t.lease_company_to_private(stub, v, caller, caller_affiliation, args[0], "private")
-				} else if  function == "private_to_scrap_merchant" { return t.private_to_scrap_merchant(stub, v, caller, caller_affiliation, args[0], "scrap_merchant")
-				}
+																if err != nil { return nil, errors.New("GET_LIFECYCLE: Error converting lifecycle") }
 
-		} else if function == "update_make"  	    { return t.update_make(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_model"        { return t.update_model(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_reg" { return t.update_registration(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "update_vin" 			{ return t.update_vin(stub, v, caller, caller_affiliation, args[0])
-        } else if function == "update_colour" 		{ return t.update_colour(stub, v, caller, caller_affiliation, args[0])
-		} else if function == "scrap_vehicle" 		{ return t.scrap_vehicle(stub, v, caller, caller_affiliation) }
+	return bytes, nil
+}
 
-		return nil, errors.New("Function of the name "+ function +" doesn't exist.")
+//=================================================================================================================================
+//	 get_lease - Returns a lease contract to its lessor, its lessee or the regulator.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_lease(stub shim.ChaincodeStubInterface, l Lease_Contract, caller string, caller_affiliation string) ([]byte, error) {
 
+	if 		l.Lessor			!= caller		&&
+			l.Lessee			!= caller		&&
+			caller_affiliation	!= AUTHORITY	{
+																return nil, errors.New("Permission Denied. get_lease")
 	}
+
+	bytes, err := json.Marshal(l)
+
+																if err != nil { return nil, errors.New("GET_LEASE: Invalid lease object") }
+
+	return bytes, nil
 }
+
 //=================================================================================================================================
-//	Query - Called on chaincode query. Takes a function name passed and calls that function. Passes the
-//  		initial arguments passed are passed on to the called function.
+//	 get_vehicles - Returns a page of the vehicles the caller can read that match the filter, in v5cID order. Takes
+//					optionally the filter as JSON, the page size, the bookmark returned with the previous page and
+//					"true" to count the matches.
 //=================================================================================================================================
-func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
+func (t *SimpleChaincode) get_vehicles(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
 
-	caller, caller_affiliation, err := t.get_caller_data(stub)
-	if err != nil { fmt.Printf("QUERY: Error retrieving caller details", err); return nil, errors.New("QUERY: Error retrieving caller details: "+err.Error()) }
+	var filter Vehicle_Filter
 
-    logger.Debug("function: ", function)
-    logger.Debug("caller: ", caller)
-    logger.Debug("affiliation: ", caller_affiliation)
+	if len(args) > 0 && args[0] != "" {
 
-	if function == "get_vehicle_details" {
-		if len(args) != 1 { fmt.Printf("Incorrect number of arguments passed"); return nil, errors.New("QUERY: Incorrect number of arguments passed") }
-		v, err := t.retrieve_v5c(stub, args[0])
-		if err != nil { fmt.Printf("QUERY: Error retrieving v5c: %s", err); return nil, errors.New("QUERY: Error retrieving v5c "+err.Error()) }
-		return t.get_vehicle_details(stub, v, caller, caller_affiliation)
-	} else if function == "check_unique_v5c" {
-		return t.check_unique_v5c(stub, args[0], caller, caller_affiliation)
-	} else if function == "get_vehicles" {
-		return t.get_vehicles(stub, caller, caller_affiliation)
-	} else if function == "get_ecert" {
-		return t.get_ecert(stub, args[0])
-	} else if function == "ping" {
-		return t.ping(stub)
+		err := json.Unmarshal([]byte(args[0]), &filter)
+
+																			if err != nil { return nil, errors.New("GET_VEHICLES: Invalid filter") }
 	}
 
-	return nil, errors.New("Received unknown function invocation " + function)
+	page_size, bookmark, err := t.parse_page_args(args, 1)
 
+																			if err != nil { return nil, err }
+
+	return t.page_vehicles(stub, caller, caller_affiliation, filter, page_size, bookmark, len(args) > 3 && args[3] == "true")
 }
 
 //=================================================================================================================================
-//	 Ping Function
-//=================================================================================================================================
-//	 Pings the peer to keep the connection alive
+//	 get_vehicles_by_owner - Returns a page of the vehicles held by an owner that the caller can read. Takes the owner and
+//							 optionally the page size, the bookmark returned with the previous page and "true" to count
+//							 the vehicles.
 //=================================================================================================================================
-func (t *SimpleChaincode) ping(stub shim.ChaincodeStubInterface) ([]byte, error) {
-	return []byte("Hello, world!"), nil
+func (t *SimpleChaincode) get_vehicles_by_owner(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+
+	page_size, bookmark, err := t.parse_page_args(args, 1)
+
+																			if err != nil { return nil, err }
+
+	return t.page_vehicles(stub, caller, caller_affiliation, Vehicle_Filter{Owner: &args[0]}, page_size, bookmark, len(args) > 3 && args[3] == "true")
 }
 
 //=================================================================================================================================
-//	 Create Function
-//=================================================================================================================================
-//	 Create Vehicle - Creates the initial JSON for the vehcile and then saves it to the ledger.
+//	 page_vehicles - Builds a page of the vehicles matching the filter. When the filter names an owner only that owner's
+//					 vehicles are read using the owner index, otherwise every vehicle is read. Vehicles are read a page at
+//					 a time until the page is full and the first match after it is found, which is the bookmark for the next
+//					 page. When count is true every remaining vehicle is read to give the total.
 //=================================================================================================================================
-func (t *SimpleChaincode) create_vehicle(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, v5cID string) ([]byte, error) {
-	var v Vehicle
+func (t *SimpleChaincode) page_vehicles(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, filter Vehicle_Filter, page_size int, bookmark string, count bool) ([]byte, error) {
 
-	v5c_ID         := "\"v5cID\":\""+v5cID+"\", "							// Variables to define the JSON
-	vin            := "\"VIN\":0, "
-	make           := "\"Make\":\"UNDEFINED\", "
-	model          := "\"Model\":\"UNDEFINED\", "
-	reg            := "\"Reg\":\"UNDEFINED\", "
-	owner          := "\"Owner\":\""+caller+"\", "
-	colour         := "\"Colour\":\"UNDEFINED\", "
-	leaseContract  := "\"LeaseContractID\":\"UNDEFINED\", "
-	status         := "\"Status\":0, "
-	scrapped       := "\"Scrapped\":false"
+	page  := Vehicle_Page{Vehicles: []json.RawMessage{}}
+	total := 0
 
-	vehicle_json := "{"+v5c_ID+vin+make+model+reg+owner+colour+leaseContract+status+scrapped+"}" 	// Concatenates the variables to create the total JSON object
+	for {
+		keys, vehicles, next, err := t.read_vehicles(stub, filter.Owner, bookmark, page_size + 1)
 
-	matched, err := regexp.Match("^[A-z][A-z][0-9]{7}", []byte(v5cID))  				// matched = true if the v5cID passed fits format of two letters followed by seven digits
+																			if err != nil { return nil, err }
 
-												if err != nil { fmt.Printf("CREATE_VEHICLE: Invalid v5cID: %s", err); return nil, errors.New("Invalid v5cID") }
+		for i, v := range vehicles {
 
-	if 				v5c_ID  == "" 	 ||
-					matched == false    {
-																		fmt.Printf("CREATE_VEHICLE: Invalid v5cID provided");
-																		return nil, errors.New("Invalid v5cID provided")
-	}
+			if !t.vehicle_matches(v, filter) { continue }
 
-	err = json.Unmarshal([]byte(vehicle_json), &v)							// Convert the JSON defined above into a vehicle object for go
+			details, err := t.get_vehicle_details(stub, v, caller, caller_affiliation)
 
-																		if err != nil { return nil, errors.New("Invalid JSON object") }
+			if err != nil { continue }									// The caller can't see this vehicle
 
-	record, err := stub.GetState(v.V5cID) 								// If not an error then a record exists so cant create a new car with this V5cID as it must be unique
+			total++
 
-																		if record != nil { return nil, errors.New("Vehicle already exists") }
+			if len(page.Vehicles) < page_size {
+				page.Vehicles = append(page.Vehicles, details)
+			} else if page.Next == "" {
+				page.Next = keys[i]
+			}
 
-	if 	caller_affiliation != AUTHORITY {							// Only the regulator can create a new v5c
+			if page.Next != "" && !count { break }
+		}
 
-		return nil, errors.New(fmt.Sprintf("Permission Denied. create_vehicle. %v === %v", caller_affiliation, AUTHORITY))
+		if next == "" || (page.Next != "" && !count) { break }
 
+		bookmark = next
 	}
 
-	_, err  = t.save_changes(stub, v)
+	if count { page.Total = &total }
 
-																		if err != nil { fmt.Printf("CREATE_VEHICLE: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+	bytes, err := json.Marshal(page)
 
-	bytes, err := stub.GetState("v5cIDs")
+																			if err != nil { return nil, errors.New("GET_VEHICLES: Error converting vehicles") }
 
-																		if err != nil { return nil, errors.New("Unable to get v5cIDs") }
+	return bytes, nil
+}
 
-	var v5cIDs V5C_Holder
+//=================================================================================================================================
+//	 get_approved_models - Returns a page of the type approvals in force for a manufacturer, in make and model order. Takes
+//						   optionally the manufacturer, the page size and the bookmark returned with the previous page.
+//						   A manufacturer can only list its own approvals, which are listed when no manufacturer is given,
+//						   the regulator can list any manufacturer's.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_approved_models(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
 
-	err = json.Unmarshal(bytes, &v5cIDs)
+	manufacturer := caller
+
+	if len(args) > 0 && args[0] != "" { manufacturer = args[0] }
 
-																		if err != nil {	return nil, errors.New("Corrupt V5C_Holder record") }
+	if 		!(caller_affiliation == MANUFACTURER && manufacturer == caller)	&&
+			caller_affiliation != AUTHORITY									{
 
-	v5cIDs.V5Cs = append(v5cIDs.V5Cs, v5cID)
+		return nil, errors.New(fmt.Sprintf("Permission Denied. get_approved_models. %v, %v === %v", caller_affiliation, manufacturer, caller))
+	}
 
+	page_size, bookmark, err := t.parse_page_args(args, 1)
 
-	bytes, err = json.Marshal(v5cIDs)
+																if err != nil { return nil, err }
 
-															if err != nil { fmt.Print("Error creating V5C_Holder record") }
+	prefix := "type_approval_" + manufacturer + "_"
 
-	err = stub.PutState("v5cIDs", bytes)
+	keys, values, _, err := t.read_range(stub, prefix, prefix + "~", bookmark, 0)
 
-															if err != nil { return nil, errors.New("Unable to put the state") }
+																if err != nil { return nil, err }
 
-	return nil, nil
+	page := Approved_Models{Manufacturer: manufacturer, Approvals: []Type_Approval{}}
 
-}
+	for i, value := range values {
 
-//=================================================================================================================================
-//	 Transfer Functions
-//=================================================================================================================================
-//	 authority_to_manufacturer
-//=================================================================================================================================
-func (t *SimpleChaincode) authority_to_manufacturer(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+		var a Type_Approval
 
-	if     	v.Status				== STATE_TEMPLATE	&&
-			v.Owner					== caller			&&
-			caller_affiliation		== AUTHORITY		&&
-			recipient_affiliation	== MANUFACTURER		&&
-			v.Scrapped				== false			{		// If the roles and users are ok
+		err = json.Unmarshal(value, &a)
 
-					v.Owner  = recipient_name		// then make the owner the new owner
-					v.Status = STATE_MANUFACTURE			// and mark it in the state of manufacture
+																if err != nil { return nil, errors.New("GET_APPROVED_MODELS: Corrupt type approval " + string(value)) }
 
-	} else {									// Otherwise if there is an error
-															fmt.Printf("AUTHORITY_TO_MANUFACTURER: Permission Denied");
-                                                            return nil, errors.New(fmt.Sprintf("Permission Denied. authority_to_manufacturer. %v %v === %v, %v === %v, %v === %v, %v === %v, %v === %v", v, v.Status, STATE_PRIVATE_OWNERSHIP, v.Owner, caller, caller_affiliation, PRIVATE_ENTITY, recipient_affiliation, SCRAP_MERCHANT, v.Scrapped, false))
+		if a.Manufacturer != manufacturer || a.Status != APPROVAL_APPROVED { continue }		// Another manufacturer whose identity starts with this one's
 
+		if len(page.Approvals) == page_size { page.Next = keys[i]; break }
 
+		page.Approvals = append(page.Approvals, a)
 	}
 
-	_, err := t.save_changes(stub, v)						// Write new state
-
-															if err != nil {	fmt.Printf("AUTHORITY_TO_MANUFACTURER: Error saving changes: %s", err); return nil, errors.New("Error saving changes")	}
+	bytes, err := json.Marshal(page)
 
-	return nil, nil									// We are Done
+																if err != nil { return nil, errors.New("GET_APPROVED_MODELS: Error converting type approvals") }
 
+	return bytes, nil
 }
 
 //=================================================================================================================================
-//	 manufacturer_to_private
+//	 get_untaxed_vehicles - Returns a page of the vehicles on the road that are neither taxed nor declared SORN, in v5cID
+//							order. Only the regulator can call it. Takes optionally the page size, the bookmark returned
+//							with the previous page and "true" to count the untaxed vehicles. Vehicles are read a page at a
+//							time in the same way as get_vehicles.
 //=================================================================================================================================
-func (t *SimpleChaincode) manufacturer_to_private(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+func (t *SimpleChaincode) get_untaxed_vehicles(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
 
-	if 		v.Make 	 == "UNDEFINED" ||
-			v.Model  == "UNDEFINED" ||
-			v.Reg 	 == "UNDEFINED" ||
-			v.Colour == "UNDEFINED" ||
-			v.VIN == 0				{					//If any part of the car is undefined it has not bene fully manufacturered so cannot be sent
-															fmt.Printf("MANUFACTURER_TO_PRIVATE: Car not fully defined")
-															return nil, errors.New(fmt.Sprintf("Car not fully defined. %v", v))
-	}
+	if caller_affiliation != AUTHORITY { return nil, errors.New("Permission Denied. get_untaxed_vehicles") }
 
-	if 		v.Status				== STATE_MANUFACTURE	&&
-			v.Owner					== caller				&&
-			caller_affiliation		== MANUFACTURER			&&
-			recipient_affiliation	== PRIVATE_ENTITY		&&
-			v.Scrapped     == false							{
+	page_size, bookmark, err := t.parse_page_args(args, 0)
 
-					v.Owner = recipient_name
-					v.Status = STATE_PRIVATE_OWNERSHIP
+																			if err != nil { return nil, err }
 
-	} else {
-        return nil, errors.New(fmt.Sprintf("Permission Denied. manufacturer_to_private. %v %v === %v, %v === %v, %v === %v, %v === %v, %v === %v", v, v.Status, STATE_PRIVATE_OWNERSHIP, v.Owner, caller, caller_affiliation, PRIVATE_ENTITY, recipient_affiliation, SCRAP_MERCHANT, v.Scrapped, false))
-    }
+	count := len(args) > 2 && args[2] == "true"
 
-	_, err := t.save_changes(stub, v)
+	now, err := t.get_tx_time(stub)
 
-	if err != nil { fmt.Printf("MANUFACTURER_TO_PRIVATE: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+																			if err != nil { return nil, err }
 
-	return nil, nil
+	page  := Vehicle_Page{Vehicles: []json.RawMessage{}}
+	total := 0
 
-}
+	for {
+		keys, vehicles, next, err := t.read_vehicles(stub, nil, bookmark, page_size + 1)
 
-//=================================================================================================================================
-//	 private_to_private
-//=================================================================================================================================
-func (t *SimpleChaincode) private_to_private(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+																			if err != nil { return nil, err }
 
-	if 		v.Status				== STATE_PRIVATE_OWNERSHIP	&&
-			v.Owner					== caller					&&
-			caller_affiliation		== PRIVATE_ENTITY			&&
-			recipient_affiliation	== PRIVATE_ENTITY			&&
-			v.Scrapped				== false					{
+		for i, v := range vehicles {
 
-					v.Owner = recipient_name
+			if 		v.Scrapped														||
+					!t.on_the_road(v)												||
+					t.tax_status(v, now) != TAX_UNTAXED								{ continue }
 
-	} else {
-        return nil, errors.New(fmt.Sprintf("Permission Denied. private_to_private. %v %v === %v, %v === %v, %v === %v, %v === %v, %v === %v", v, v.Status, STATE_PRIVATE_OWNERSHIP, v.Owner, caller, caller_affiliation, PRIVATE_ENTITY, recipient_affiliation, SCRAP_MERCHANT, v.Scrapped, false))
-	}
+			total++
 
-	_, err := t.save_changes(stub, v)
+			if len(page.Vehicles) < page_size {
 
-															if err != nil { fmt.Printf("PRIVATE_TO_PRIVATE: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+				v.TaxStatus = TAX_UNTAXED
 
-	return nil, nil
+				details, err := json.Marshal(v)
 
-}
+																			if err != nil { return nil, errors.New("GET_UNTAXED_VEHICLES: Error converting vehicle") }
 
-//=================================================================================================================================
-//	 private_to_lease_company
-//=================================================================================================================================
-func (t *SimpleChaincode) private_to_lease_company(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+				page.Vehicles = append(page.Vehicles, details)
 
-	if 		v.Status				== STATE_PRIVATE_OWNERSHIP	&&
-			v.Owner					== caller					&&
-			caller_affiliation		== PRIVATE_ENTITY			&&
-			recipient_affiliation	== LEASE_COMPANY			&&
-            v.Scrapped     			== false					{
+			} else if page.Next == "" {
+				page.Next = keys[i]
+			}
 
-					v.Owner = recipient_name
+			if page.Next != "" && !count { break }
+		}
 
-	} else {
-        return nil, errors.New(fmt.Sprintf("Permission denied. private_to_lease_company. %v === %v, %v === %v, %v === %v, %v === %v, %v === %v", v.Status, STATE_PRIVATE_OWNERSHIP, v.Owner, caller, caller_affiliation, PRIVATE_ENTITY, recipient_affiliation, SCRAP_MERCHANT, v.Scrapped, false))
+		if next == "" || (page.Next != "" && !count) { break }
 
+		bookmark = next
 	}
 
-	_, err := t.save_changes(stub, v)
-															if err != nil { fmt.Printf("PRIVATE_TO_LEASE_COMPANY: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+	if count { page.Total = &total }
 
-	return nil, nil
+	bytes, err := json.Marshal(page)
 
+																			if err != nil { return nil, errors.New("GET_UNTAXED_VEHICLES: Error converting vehicles") }
+
+	return bytes, nil
 }
 
 //=================================================================================================================================
-//	 lease_company_to_private
+//	 get_vehicle_by_index - Looks up a vehicle by VIN for get_vehicle_by_vin or by registration for get_vehicle_by_reg and
+//							returns its details if the caller can read it.
 //=================================================================================================================================
-func (t *SimpleChaincode) lease_company_to_private(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+func (t *SimpleChaincode) get_vehicle_by_index(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, function string, value string) ([]byte, error) {
 
-	if		v.Status				== STATE_PRIVATE_OWNERSHIP	&&
-			v.Owner  				== caller					&&
-			caller_affiliation		== LEASE_COMPANY			&&
-			recipient_affiliation	== PRIVATE_ENTITY			&&
-			v.Scrapped				== false					{
+	var v5cID string
 
-				v.Owner = recipient_name
+	if function == "get_vehicle_by_vin" {
 
-	} else {
-		return nil, errors.New(fmt.Sprintf("Permission Denied. lease_company_to_private. %v %v === %v, %v === %v, %v === %v, %v === %v, %v === %v", v, v.Status, STATE_PRIVATE_OWNERSHIP, v.Owner, caller, caller_affiliation, PRIVATE_ENTITY, recipient_affiliation, SCRAP_MERCHANT, v.Scrapped, false))
-	}
+		key := "vin_" + strings.ToUpper(value)
 
-	_, err := t.save_changes(stub, v)
-															if err != nil { fmt.Printf("LEASE_COMPANY_TO_PRIVATE: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+		bytes, err := stub.GetState(key)
 
-	return nil, nil
+																			if err != nil { return nil, errors.New("Unable to get index " + key) }
 
-}
+		v5cID = string(bytes)
 
-//=================================================================================================================================
-//	 private_to_scrap_merchant
-//=================================================================================================================================
-func (t *SimpleChaincode) private_to_scrap_merchant(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, recipient_name string, recipient_affiliation string) ([]byte, error) {
+	} else {
 
-	if		v.Status				== STATE_PRIVATE_OWNERSHIP	&&
-			v.Owner					== caller					&&
-			caller_affiliation		== PRIVATE_ENTITY			&&
-			recipient_affiliation	== SCRAP_MERCHANT			&&
-			v.Scrapped				== false					{
+		p, err := t.retrieve_plate(stub, t.normalise_registration(value))
 
-					v.Owner = recipient_name
-					v.Status = STATE_BEING_SCRAPPED
+																			if err != nil { return nil, err }
 
-	} else {
-        return nil, errors.New(fmt.Sprintf("Permission Denied. private_to_scrap_merchant. %v %v === %v, %v === %v, %v === %v, %v === %v, %v === %v", v, v.Status, STATE_PRIVATE_OWNERSHIP, v.Owner, caller, caller_affiliation, PRIVATE_ENTITY, recipient_affiliation, SCRAP_MERCHANT, v.Scrapped, false))
+		if p.Status == PLATE_ASSIGNED { v5cID = p.V5cID }					// A retained plate isn't on any vehicle
 	}
+																			if v5cID == "" { return nil, errors.New("No vehicle found for " + value) }
 
-	_, err := t.save_changes(stub, v)
-
-															if err != nil { fmt.Printf("PRIVATE_TO_SCRAP_MERCHANT: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+	v, err := t.retrieve_v5c(stub, v5cID)
 
-	return nil, nil
+																			if err != nil { return nil, err }
 
+	return t.get_vehicle_details(stub, v, caller, caller_affiliation)
 }
 
 //=================================================================================================================================
-//	 Update Functions
+//	 vehicle_matches - Returns true if the vehicle matches every field set in the filter.
 //=================================================================================================================================
-//	 update_vin
+func (t *SimpleChaincode) vehicle_matches(v Vehicle, f Vehicle_Filter) bool {
+
+	return	(f.Owner           == nil || *f.Owner           == v.Owner)           &&
+			(f.Status          == nil || *f.Status          == v.Status)          &&
+			(f.Make            == nil || *f.Make            == v.Make)            &&
+			(f.Model           == nil || *f.Model           == v.Model)           &&
+			(f.Colour          == nil || *f.Colour          == v.Colour)          &&
+			(f.Scrapped        == nil || *f.Scrapped        == v.Scrapped)        &&
+			(f.LeaseContractID == nil || *f.LeaseContractID == v.LeaseContractID) &&
+			(f.Keeper          == nil || *f.Keeper          == v.Keeper)
+}
+
 //=================================================================================================================================
-func (t *SimpleChaincode) update_vin(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+//	 get_odometer_history - Returns a page of the vehicle's odometer readings, oldest first, with its mileage discrepancy
+//							flag. Takes the v5cID and optionally the page size and the bookmark returned with the
+//							previous page.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_odometer_history(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
 
-	new_vin, err := strconv.Atoi(string(new_value)) 		                // will return an error if the new vin contains non numerical chars
+	if !t.can_read_vehicle(v, caller, caller_affiliation) { return nil, errors.New("Permission Denied. get_odometer_history") }
 
-															if err != nil || len(string(new_value)) != 15 { return nil, errors.New("Invalid value passed for new VIN") }
+	page_size, bookmark, err := t.parse_page_args(args, 1)
 
-	if 		v.Status			== STATE_MANUFACTURE	&&
-			v.Owner				== caller				&&
-			caller_affiliation	== MANUFACTURER			&&
-			v.VIN				== 0					&&			// Can't change the VIN after its initial assignment
-			v.Scrapped			== false				{
+																if err != nil { return nil, err }
 
-					v.VIN = new_vin					// Update to the new value
-	} else {
+	prefix := "odometer_" + v.V5cID + "_"
 
-        return nil, errors.New(fmt.Sprintf("Permission denied. update_vin %v %v %v %v %v", v.Status, STATE_MANUFACTURE, v.Owner, caller, v.VIN, v.Scrapped))
+	_, values, next, err := t.read_range(stub, prefix, prefix + "~", bookmark, page_size)
 
-	}
+																if err != nil { return nil, err }
 
-	_, err  = t.save_changes(stub, v)						// Save the changes in the blockchain
+	page := Odometer_History{V5cID: v.V5cID, MileageDiscrepancy: v.MileageDiscrepancy, Readings: []Odometer_Reading{}, Next: next}
 
-															if err != nil { fmt.Printf("UPDATE_VIN: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+	for _, value := range values {
 
-	return nil, nil
+		var r Odometer_Reading
 
-}
+		err = json.Unmarshal(value, &r)
+
+																if err != nil { return nil, errors.New("GET_ODOMETER_HISTORY: Corrupt odometer reading " + string(value)) }
+
+		page.Readings = append(page.Readings, r)
+	}
+
+	bytes, err := json.Marshal(page)
 
+																if err != nil { return nil, errors.New("GET_ODOMETER_HISTORY: Error converting readings") }
+
+	return bytes, nil
+}
 
 //=================================================================================================================================
-//	 update_registration
+//	 get_inspections - Returns a page of the vehicle's inspections, oldest first. Takes the v5cID and optionally the page
+//					   size and the bookmark returned with the previous page.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_registration(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+func (t *SimpleChaincode) get_inspections(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
 
+	if !t.can_read_vehicle(v, caller, caller_affiliation) && caller_affiliation != INSPECTOR { return nil, errors.New("Permission Denied. get_inspections") }
 
-	if		v.Owner				== caller			&&
-			caller_affiliation	!= SCRAP_MERCHANT	&&
-			v.Scrapped			== false			{
+	page_size, bookmark, err := t.parse_page_args(args, 1)
 
-					v.Reg = new_value
+																if err != nil { return nil, err }
 
-	} else {
-        return nil, errors.New(fmt.Sprint("Permission denied. update_registration"))
-	}
+	prefix := "inspection_" + v.V5cID + "_"
 
-	_, err := t.save_changes(stub, v)
+	_, values, next, err := t.read_range(stub, prefix, prefix + "~", bookmark, page_size)
 
-															if err != nil { fmt.Printf("UPDATE_REGISTRATION: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+																if err != nil { return nil, err }
 
-	return nil, nil
+	page := Inspection_History{V5cID: v.V5cID, Inspections: []Inspection{}, Next: next}
 
-}
+	for _, value := range values {
 
-//=================================================================================================================================
-//	 update_colour
-//=================================================================================================================================
-func (t *SimpleChaincode) update_colour(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+		var i Inspection
 
-	if 		v.Owner				== caller				&&
-			caller_affiliation	== MANUFACTURER			&&/*((v.Owner				== caller			&&
-			caller_affiliation	== MANUFACTURER)		||
-			caller_affiliation	== AUTHORITY)			&&*/
-			v.Scrapped			== false				{
+		err = json.Unmarshal(value, &i)
 
-					v.Colour = new_value
-	} else {
+																if err != nil { return nil, errors.New("GET_INSPECTIONS: Corrupt inspection " + string(value)) }
 
-		return nil, errors.New(fmt.Sprint("Permission denied. update_colour %t %t %t" + v.Owner == caller, caller_affiliation == MANUFACTURER, v.Scrapped))
+		page.Inspections = append(page.Inspections, i)
 	}
 
-	_, err := t.save_changes(stub, v)
-
-		if err != nil { fmt.Printf("UPDATE_COLOUR: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+	bytes, err := json.Marshal(page)
 
-	return nil, nil
+																if err != nil { return nil, errors.New("GET_INSPECTIONS: Error converting inspections") }
 
+	return bytes, nil
 }
 
 //=================================================================================================================================
-//	 update_make
+//	 get_inspection_policy - Returns the regulator's inspection policy.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_make(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+func (t *SimpleChaincode) get_inspection_policy(stub shim.ChaincodeStubInterface) ([]byte, error) {
 
-	if 		v.Status			== STATE_MANUFACTURE	&&
-			v.Owner				== caller				&&
-			caller_affiliation	== MANUFACTURER			&&
-			v.Scrapped			== false				{
+	policy, err := t.retrieve_inspection_policy(stub)
 
-					v.Make = new_value
-	} else {
+																if err != nil { return nil, err }
 
-        return nil, errors.New(fmt.Sprint("Permission denied. update_make %t %t %t" + v.Owner == caller, caller_affiliation == MANUFACTURER, v.Scrapped))
+	bytes, err := json.Marshal(policy)
 
+																if err != nil { return nil, errors.New("GET_INSPECTION_POLICY: Error converting inspection policy") }
 
-	}
+	return bytes, nil
+}
 
-	_, err := t.save_changes(stub, v)
+//=================================================================================================================================
+//	 get_open_recalls - Returns the recalls on the vehicle that haven't been remedied. Only the owner and the regulator
+//						can see them.
+//=================================================================================================================================
+func (t *SimpleChaincode) get_open_recalls(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
 
-															if err != nil { fmt.Printf("UPDATE_MAKE: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+	if !t.can_read_vehicle(v, caller, caller_affiliation) { return nil, errors.New("Permission Denied. get_open_recalls") }
 
-	return nil, nil
+	open := Open_Recalls{V5cID: v.V5cID, Recalls: t.open_recalls(v)}
+
+	if open.Recalls == nil { open.Recalls = []Vehicle_Recall{} }
 
+	bytes, err := json.Marshal(open)
+
+																if err != nil { return nil, errors.New("GET_OPEN_RECALLS: Error converting recalls") }
+
+	return bytes, nil
 }
 
 //=================================================================================================================================
-//	 update_model
+//	 get_damage_history - Returns a page of the damage recorded against the vehicle, oldest first, with its write-off
+//						  category. Takes the v5cID and optionally the page size and the bookmark returned with the
+//						  previous page. Insurers can read the damage history of any vehicle.
 //=================================================================================================================================
-func (t *SimpleChaincode) update_model(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, new_value string) ([]byte, error) {
+func (t *SimpleChaincode) get_damage_history(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string, args []string) ([]byte, error) {
 
-	if 		v.Status			== STATE_MANUFACTURE	&&
-			v.Owner				== caller				&&
-			caller_affiliation	== MANUFACTURER			&&
-			v.Scrapped			== false				{
+	if !t.can_read_vehicle(v, caller, caller_affiliation) && caller_affiliation != INSURER { return nil, errors.New("Permission Denied. get_damage_history") }
 
-					v.Model = new_value
+	page_size, bookmark, err := t.parse_page_args(args, 1)
 
-	} else {
-        return nil, errors.New(fmt.Sprint("Permission denied. update_model %t %t %t" + v.Owner == caller, caller_affiliation == MANUFACTURER, v.Scrapped))
+																if err != nil { return nil, err }
 
-	}
+	prefix := "damage_" + v.V5cID + "_"
 
-	_, err := t.save_changes(stub, v)
+	_, values, next, err := t.read_range(stub, prefix, prefix + "~", bookmark, page_size)
 
-															if err != nil { fmt.Printf("UPDATE_MODEL: Error saving changes: %s", err); return nil, errors.New("Error saving changes") }
+																if err != nil { return nil, err }
 
-	return nil, nil
+	page := Damage_History{V5cID: v.V5cID, WriteOff: v.WriteOff, Events: []Damage_Event{}, Next: next}
+
+	for _, value := range values {
+
+		var d Damage_Event
+
+		err = json.Unmarshal(value, &d)
 
+																if err != nil { return nil, errors.New("GET_DAMAGE_HISTORY: Corrupt damage event " + string(value)) }
+
+		page.Events = append(page.Events, d)
+	}
+
+	bytes, err := json.Marshal(page)
+
+																if err != nil { return nil, errors.New("GET_DAMAGE_HISTORY: Error converting damage history") }
+
+	return bytes, nil
 }
 
 //=================================================================================================================================
-//	 scrap_vehicle
+//	 get_plate - Returns the plate for a registration. Only the regulator, the owner of the vehicle it is on and the holder
+//				 of its retention certificate can see it.
 //=================================================================================================================================
-func (t *SimpleChaincode) scrap_vehicle(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+func (t *SimpleChaincode) get_plate(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, registration string) ([]byte, error) {
 
-	if		v.Status			== STATE_BEING_SCRAPPED	&&
-			v.Owner				== caller				&&
-			caller_affiliation	== SCRAP_MERCHANT		&&
-			v.Scrapped			== false				{
+	p, err := t.retrieve_plate(stub, t.normalise_registration(registration))
 
-					v.Scrapped = true
+																if err != nil { return nil, err }
+																if p.Status == "" { return nil, errors.New("GET_PLATE: Registration " + registration + " has not been issued") }
 
+	allowed := caller_affiliation == AUTHORITY
+
+	if p.Status == PLATE_RETAINED {
+		allowed = allowed || p.Certificate.Holder == caller
 	} else {
-		return nil, errors.New("Permission denied. scrap_vehicle")
+		v, err := t.retrieve_v5c(stub, p.V5cID)
+																if err != nil { return nil, err }
+		allowed = allowed || v.Owner == caller
 	}
 
-	_, err := t.save_changes(stub, v)
+	if !allowed { return nil, errors.New("Permission Denied. get_plate") }
 
-															if err != nil { fmt.Printf("SCRAP_VEHICLE: Error saving changes: %s", err); return nil, errors.New("SCRAP_VEHICLError saving changes") }
+	bytes, err := json.Marshal(p)
 
-	return nil, nil
+																if err != nil { return nil, errors.New("GET_PLATE: Error converting plate") }
 
+	return bytes, nil
 }
 
 //=================================================================================================================================
-//	 Read Functions
-//=================================================================================================================================
-//	 get_vehicle_details
+//	 verify_logbook - Tells anyone presented with a paper logbook whether it is the vehicle's current one. Takes the v5cID
+//					  and the document reference printed on the logbook.
 //=================================================================================================================================
-func (t *SimpleChaincode) get_vehicle_details(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
+func (t *SimpleChaincode) verify_logbook(stub shim.ChaincodeStubInterface, v Vehicle, document_ref string) ([]byte, error) {
 
-	bytes, err := json.Marshal(v)
+	check := Logbook_Check{V5cID: v.V5cID, DocumentRef: document_ref, Status: LOGBOOK_UNKNOWN}
 
-																if err != nil { return nil, errors.New("GET_VEHICLE_DETAILS: Invalid vehicle object") }
+	bytes, err := stub.GetState("logbook_" + v.V5cID + "_" + document_ref)
 
-	if 		v.Owner				== caller		||
-			caller_affiliation	== AUTHORITY	{
+																if err != nil { return nil, errors.New("VERIFY_LOGBOOK: Unable to get logbook " + document_ref) }
 
-					return bytes, nil
-	} else {
-																return nil, errors.New("Permission Denied. get_vehicle_details")
+	if bytes != nil && document_ref != "" {
+
+		var l Logbook
+
+		err = json.Unmarshal(bytes, &l)
+
+																if err != nil { return nil, errors.New("VERIFY_LOGBOOK: Corrupt logbook " + string(bytes)) }
+
+		check.Issued  = l.Issued
+		check.Current = v.Logbook != nil && v.Logbook.DocumentRef == document_ref
+
+		if check.Current { check.Status = LOGBOOK_CURRENT } else { check.Status = LOGBOOK_SUPERSEDED }
 	}
 
+	bytes, err = json.Marshal(check)
+
+																if err != nil { return nil, errors.New("VERIFY_LOGBOOK: Error converting logbook check") }
+
+	return bytes, nil
 }
 
 //=================================================================================================================================
-//	 get_vehicles
+//	 check_finance - Returns the active liens on the vehicle. Anyone can check whether a vehicle has outstanding finance
+//					 and who the lenders are, the amounts are only shown to the lender, the owner and the regulator.
 //=================================================================================================================================
+func (t *SimpleChaincode) check_finance(stub shim.ChaincodeStubInterface, v Vehicle, caller string, caller_affiliation string) ([]byte, error) {
 
-func (t *SimpleChaincode) get_vehicles(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
-	bytes, err := stub.GetState("v5cIDs")
+	liens, err := t.retrieve_liens(stub, v.V5cID)
 
-																			if err != nil { return nil, errors.New("Unable to get v5cIDs") }
+																if err != nil { return nil, err }
 
-	var v5cIDs V5C_Holder
+	check := Finance_Check{V5cID: v.V5cID, Liens: []Lien{}}
 
-	err = json.Unmarshal(bytes, &v5cIDs)
+	for _, l := range liens {
 
-																			if err != nil {	return nil, errors.New("Corrupt V5C_Holder") }
+		if l.Status != LIEN_ACTIVE { continue }
 
-	result := "["
+		if l.Lender != caller && v.Owner != caller && caller_affiliation != AUTHORITY { l.Amount = 0 }		// Not even the keeper sees the amount
 
-	var temp []byte
-	var v Vehicle
+		check.Liens = append(check.Liens, l)
+	}
 
-	for _, v5c := range v5cIDs.V5Cs {
+	check.Financed = len(check.Liens) > 0
 
-		v, err = t.retrieve_v5c(stub, v5c)
+	bytes, err := json.Marshal(check)
 
-		if err != nil {return nil, errors.New("Failed to retrieve V5C")}
+																if err != nil { return nil, errors.New("CHECK_FINANCE: Error converting liens") }
 
-		temp, err = t.get_vehicle_details(stub, v, caller, caller_affiliation)
+	return bytes, nil
+}
 
-		if err == nil {
-			result += string(temp) + ","
-		}
-	}
+//=================================================================================================================================
+//	 check_stolen - Can be called by anyone. Returns whether the vehicle is reported stolen and the date of the report,
+//					nothing else about the vehicle or the report.
+//=================================================================================================================================
+func (t *SimpleChaincode) check_stolen(v Vehicle) ([]byte, error) {
 
-	if len(result) == 1 {
-		result = "[]"
-	} else {
-		result = result[:len(result)-1] + "]"
-	}
+	result := Stolen_Check{V5cID: v.V5cID, Stolen: v.Stolen != nil}
+
+	if v.Stolen != nil { result.Reported = v.Stolen.Date }
+
+	bytes, err := json.Marshal(result)
+
+																if err != nil { return nil, errors.New("CHECK_STOLEN: Error converting result") }
 
-	return []byte(result), nil
+	return bytes, nil
 }
 
 //=================================================================================================================================
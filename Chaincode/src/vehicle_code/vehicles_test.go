@@ -0,0 +1,1200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Test participants - The participants a test can register by identity. The regulator is known by its certificate alone.
+//==============================================================================================================================
+const   TEST_START      =  1700000000							// The transaction time until a test moves it on
+const   TEST_APPROVAL   =  "e11*2007/46*0001"
+
+const   DVLA            =  "DVLA"
+const   JLR             =  "Jaguar_Land_Rover"
+const   BMW             =  "BMW"
+const   DEALER          =  "Beechvale_Group"
+const   JOE             =  "Joe_Payne"
+const   ANDREW          =  "Andrew_Hurt"
+const   LEASER          =  "LeaseCan"
+const   SCRAPPER        =  "Cray_Bros"
+const   OFFICER         =  "Met_Police"
+const   GARAGE          =  "Kwik_Fit"
+const   BANK            =  "Black_Horse"
+const   INSURANCE       =  "Direct_Line"
+
+var test_participants = map[string]Participant{
+	JLR:       {Identity: JLR,       Role: MANUFACTURER,   WMIs: []string{"SAJ"}},
+	BMW:       {Identity: BMW,       Role: MANUFACTURER,   WMIs: []string{"WBA"}},
+	DEALER:    {Identity: DEALER,    Role: PRIVATE_ENTITY, Type: DEALERSHIP},
+	JOE:       {Identity: JOE,       Role: PRIVATE_ENTITY},
+	ANDREW:    {Identity: ANDREW,    Role: PRIVATE_ENTITY},
+	LEASER:    {Identity: LEASER,    Role: LEASE_COMPANY},
+	SCRAPPER:  {Identity: SCRAPPER,  Role: SCRAP_MERCHANT},
+	OFFICER:   {Identity: OFFICER,   Role: POLICE},
+	GARAGE:    {Identity: GARAGE,    Role: INSPECTOR},
+	BANK:      {Identity: BANK,      Role: LENDER},
+	INSURANCE: {Identity: INSURANCE, Role: INSURER},
+}
+
+// VINs under Jaguar Land Rover's WMI with valid check digits, in serial number order
+var test_vins = []string{"SAJAA4DA91V000001", "SAJAA4DA01V000002", "SAJAA4DA21V000003"}
+
+const   BMW_VIN         =  "WBAAA4DA41V000001"
+
+//==============================================================================================================================
+//	 test_stub - The shim's MockStub with what it leaves out filled in. The caller's certificate attributes and the
+//				 transaction time are set by the test, events are kept and range queries return every key in the range in
+//				 order. Reading the key broken fails, as a peer that can't read its state would.
+//==============================================================================================================================
+type test_event struct {
+	name    string
+	payload []byte
+}
+
+type test_stub struct {
+	*shim.MockStub
+	username string
+	role     string
+	now      int64
+	events   []test_event
+	broken   string
+}
+
+func (s *test_stub) tx_seconds() int64 { return s.now }
+
+func (s *test_stub) ReadCertAttribute(name string) ([]byte, error) {
+
+	if name == "username" { return []byte(s.username), nil }
+	if name == "role"     { return []byte(s.role), nil }
+
+	return nil, errors.New("No attribute " + name)
+}
+
+func (s *test_stub) GetState(key string) ([]byte, error) {
+
+	if key == s.broken { return nil, errors.New("State unavailable") }
+
+	return s.MockStub.GetState(key)
+}
+
+func (s *test_stub) SetEvent(name string, payload []byte) error {
+
+	s.events = append(s.events, test_event{name, payload})
+
+	return nil
+}
+
+func (s *test_stub) RangeQueryState(start_key string, end_key string) (shim.StateRangeQueryIteratorInterface, error) {
+
+	iter := &test_iterator{}
+
+	for key := range s.State {
+		if key >= start_key && key <= end_key { iter.keys = append(iter.keys, key) }
+	}
+
+	sort.Strings(iter.keys)
+
+	for _, key := range iter.keys { iter.values = append(iter.values, s.State[key]) }
+
+	return iter, nil
+}
+
+type test_iterator struct {
+	keys   []string
+	values [][]byte
+	pos    int
+}
+
+func (i *test_iterator) HasNext() bool { return i.pos < len(i.keys) }
+func (i *test_iterator) Close() error  { return nil }
+
+func (i *test_iterator) Next() (string, []byte, error) {
+
+	if !i.HasNext() { return "", nil, errors.New("No more keys") }
+
+	i.pos++
+
+	return i.keys[i.pos-1], i.values[i.pos-1], nil
+}
+
+//==============================================================================================================================
+//	 test_chain - The chaincode on a test stub with the participants a test needs registered. Every invoke is a new
+//				  transaction. Registering Jaguar Land Rover also approves it to build the Jaguar F-Type.
+//==============================================================================================================================
+type test_chain struct {
+	t      *testing.T
+	cc     *SimpleChaincode
+	stub   *test_stub
+	roles  map[string]string
+	tx     int
+}
+
+func new_test_chain(t *testing.T, identities ...string) *test_chain {
+
+	cc := new(SimpleChaincode)
+
+	c := &test_chain{t: t, cc: cc, stub: &test_stub{MockStub: shim.NewMockStub("vehicle_code", cc), now: TEST_START}, roles: map[string]string{DVLA: AUTHORITY}}
+
+	for _, identity := range identities {
+
+		p := test_participants[identity]
+
+		bytes, _ := json.Marshal(p)
+
+		c.roles[identity] = p.Role
+		c.must_invoke(DVLA, "register_participant", string(bytes))
+	}
+
+	if c.roles[JLR] != "" { c.must_invoke(DVLA, "approve_type", JLR, "Jaguar", "F-Type", TEST_APPROVAL) }
+
+	return c
+}
+
+func (c *test_chain) invoke(caller string, function string, args ...string) ([]byte, error) {
+
+	c.tx++
+
+	c.stub.MockTransactionStart(fmt.Sprintf("tx%04d", c.tx))
+	c.stub.username, c.stub.role, c.stub.events = caller, c.roles[caller], nil
+
+	return c.cc.Invoke(c.stub, function, args)
+}
+
+func (c *test_chain) query(caller string, function string, args ...string) ([]byte, error) {
+
+	c.stub.username, c.stub.role = caller, c.roles[caller]
+
+	return c.cc.Query(c.stub, function, args)
+}
+
+func (c *test_chain) must_invoke(caller string, function string, args ...string) []byte {
+
+	bytes, err := c.invoke(caller, function, args...)
+
+	if err != nil { c.t.Fatalf("%s %v by %s: %s", function, args, caller, err) }
+
+	return bytes
+}
+
+func (c *test_chain) must_fail(message string, caller string, function string, args ...string) {
+
+	_, err := c.invoke(caller, function, args...)
+
+	if err == nil { c.t.Fatalf("%s %v by %s succeeded, want error %q", function, args, caller, message) }
+
+	if !strings.Contains(err.Error(), message) { c.t.Fatalf("%s %v by %s: got error %q, want %q", function, args, caller, err, message) }
+}
+
+func (c *test_chain) must_query(result interface{}, caller string, function string, args ...string) {
+
+	bytes, err := c.query(caller, function, args...)
+
+	if err != nil { c.t.Fatalf("%s %v by %s: %s", function, args, caller, err) }
+
+	if result == nil { return }
+
+	err = json.Unmarshal(bytes, result)
+
+	if err != nil { c.t.Fatalf("%s %v by %s: invalid result %s", function, args, caller, bytes) }
+}
+
+func (c *test_chain) query_fails(message string, caller string, function string, args ...string) {
+
+	_, err := c.query(caller, function, args...)
+
+	if err == nil || !strings.Contains(err.Error(), message) { c.t.Fatalf("%s %v by %s: got error %v, want %q", function, args, caller, err, message) }
+}
+
+func (c *test_chain) vehicle(v5cID string) Vehicle {
+
+	var v Vehicle
+
+	c.must_query(&v, DVLA, "get_vehicle_details", v5cID)
+
+	return v
+}
+
+//==============================================================================================================================
+//	 vehicle_page - Queries a page of vehicles and returns it with the v5cIDs of the vehicles on it.
+//==============================================================================================================================
+func (c *test_chain) vehicle_page(caller string, function string, args ...string) (Vehicle_Page, []string) {
+
+	var page Vehicle_Page
+
+	c.must_query(&page, caller, function, args...)
+
+	v5cIDs := []string{}
+
+	for _, raw := range page.Vehicles {
+
+		var v Vehicle
+
+		if json.Unmarshal(raw, &v) != nil { c.t.Fatalf("%s: invalid vehicle %s", function, raw) }
+
+		v5cIDs = append(v5cIDs, v.V5cID)
+	}
+
+	return page, v5cIDs
+}
+
+//==============================================================================================================================
+//	 event - Returns the event set by the last transaction, which must set exactly one.
+//==============================================================================================================================
+func (c *test_chain) event() Vehicle_Event {
+
+	if len(c.stub.events) != 1 { c.t.Fatalf("got %d events for the transaction, want 1", len(c.stub.events)) }
+
+	var e Vehicle_Event
+
+	if json.Unmarshal(c.stub.events[0].payload, &e) != nil { c.t.Fatalf("invalid event %s", c.stub.events[0].payload) }
+
+	if e.Type != c.stub.events[0].name { c.t.Fatalf("event named %s has type %s", c.stub.events[0].name, e.Type) }
+
+	return e
+}
+
+//==============================================================================================================================
+//	 transfer - Offers the vehicle with the lifecycle transfer function and has the recipient accept it.
+//==============================================================================================================================
+func (c *test_chain) transfer(caller string, function string, recipient string, v5cID string) {
+
+	c.must_invoke(caller, function, recipient, v5cID)
+	c.must_invoke(recipient, "accept_transfer", v5cID)
+}
+
+//==============================================================================================================================
+//	 build_vehicle - Creates a Jaguar F-Type with Jaguar Land Rover ready to be sold. sell_vehicle sells it on to the
+//					 dealership.
+//==============================================================================================================================
+func (c *test_chain) build_vehicle(v5cID string, vin string, reg string) {
+
+	c.must_invoke(DVLA, "create_vehicle", v5cID)
+	c.transfer(DVLA, "authority_to_manufacturer", JLR, v5cID)
+	c.must_invoke(JLR, "update_vehicle", v5cID, `{"VIN":"` + vin + `", "make":"Jaguar", "model":"F-Type", "reg":"` + reg + `", "colour":"Red"}`)
+}
+
+func (c *test_chain) sell_vehicle(v5cID string, vin string, reg string) {
+
+	c.build_vehicle(v5cID, vin, reg)
+	c.transfer(JLR, "manufacturer_to_private", DEALER, v5cID)
+}
+
+func check(t *testing.T, what string, got interface{}, want interface{}) {
+
+	if !reflect.DeepEqual(got, want) { t.Fatalf("%s: got %v, want %v", what, got, want) }
+}
+
+//==============================================================================================================================
+//	 Vehicle history
+//==============================================================================================================================
+func TestVehicleHistory(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	var page History_Page
+
+	c.must_query(&page, DEALER, "get_vehicle_history", "AB0000001")
+
+	var functions []string
+
+	for _, e := range page.Entries { functions = append(functions, e.Function) }
+
+	check(t, "functions", functions, []string{"create_vehicle", "authority_to_manufacturer", "update_vehicle", "manufacturer_to_private"})
+
+	last := page.Entries[3]
+
+	check(t, "sale", []interface{}{last.Sequence, last.PreviousOwner, last.NewOwner, last.NewStatus, last.Timestamp}, []interface{}{3, JLR, DEALER, STATE_PRIVATE_OWNERSHIP, int64(TEST_START)})
+	check(t, "next", page.Next, "")
+
+	var first, second History_Page
+
+	c.must_query(&first, DEALER, "get_vehicle_history", "AB0000001", "3")
+	c.must_query(&second, DEALER, "get_vehicle_history", "AB0000001", "3", first.Next)
+
+	check(t, "first page", len(first.Entries), 3)
+	check(t, "second page", second.Entries[0].Function, "manufacturer_to_private")
+	check(t, "last page", second.Next, "")
+
+	c.query_fails("Permission Denied", JOE, "get_vehicle_history", "AB0000001")
+}
+
+func TestHistoryKeepsOnlyV5CChanges(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	c.must_invoke(DEALER, "record_odometer", "AB0000001", "1000", "sale")		// Kept in the odometer readings
+	c.must_invoke(DVLA, "freeze_vehicle", "AB0000001", "FRAUD", "CASE1")
+	c.must_invoke(DVLA, "unfreeze_vehicle", "AB0000001", "CASE1")
+	c.must_invoke(DVLA, "seize_vehicle", "AB0000001", "CRIME", "CASE2")			// Changes the owner
+
+	var page History_Page
+
+	c.must_query(&page, DVLA, "get_vehicle_history", "AB0000001")
+
+	check(t, "entries", len(page.Entries), 5)
+	check(t, "seized", []interface{}{page.Entries[4].Function, page.Entries[4].NewOwner}, []interface{}{"seize_vehicle", DVLA})
+}
+
+//==============================================================================================================================
+//	 Lease contracts
+//==============================================================================================================================
+func TestLeaseContracts(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, ANDREW, LEASER)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+	c.transfer(DEALER, "private_to_lease_company", LEASER, "AB0000001")
+
+	start, end := fmt.Sprint(TEST_START), fmt.Sprint(TEST_START + SECONDS_PER_YEAR)
+
+	c.must_fail("Permission Denied", DEALER, "create_lease", "L1", "AB0000001", JOE, start, end, "300", "10000")
+	c.must_fail("must end after it starts", LEASER, "create_lease", "L1", "AB0000001", JOE, end, start, "300", "10000")
+
+	c.stub.broken = "lease_L1"
+	c.must_fail("Unable to look up lease L1", LEASER, "create_lease", "L1", "AB0000001", JOE, start, end, "300", "10000")
+	c.stub.broken = ""
+
+	c.must_invoke(LEASER, "create_lease", "L1", "AB0000001", JOE, start, end, "300", "10000")
+
+	c.must_fail("Permission Denied", ANDREW, "activate_lease", "L1")
+	c.must_invoke(JOE, "activate_lease", "L1")
+
+	v := c.vehicle("AB0000001")
+
+	check(t, "leased out", []interface{}{v.Status, v.LeaseContractID, v.Keeper, v.Owner}, []interface{}{STATE_LEASED_OUT, "L1", JOE, LEASER})
+
+	c.must_fail("Permission Denied", JOE, "record_lease_payment", "L1", "300")
+	c.must_invoke(LEASER, "record_lease_payment", "L1", "300")
+
+	var l Lease_Contract
+
+	c.must_query(&l, JOE, "get_lease", "L1")
+
+	check(t, "payments", []interface{}{l.Status, l.PaymentsMade, l.AmountPaid}, []interface{}{LEASE_ACTIVE, 1, 300})
+
+	c.query_fails("Permission Denied", ANDREW, "get_lease", "L1")
+
+	c.stub.now += SECONDS_PER_YEAR + 1										// The lease runs out when the vehicle is next touched
+
+	c.must_invoke(LEASER, "record_odometer", "AB0000001", "12000", "return")
+
+	v = c.vehicle("AB0000001")
+
+	check(t, "returned", []interface{}{v.Status, v.LeaseContractID, v.Keeper}, []interface{}{STATE_LEASE_OWNERSHIP, "UNDEFINED", ""})
+
+	c.must_query(&l, LEASER, "get_lease", "L1")
+
+	check(t, "lease status", l.Status, LEASE_EXPIRED)
+
+	now := c.stub.now
+
+	c.must_invoke(LEASER, "create_lease", "L2", "AB0000001", ANDREW, fmt.Sprint(now), fmt.Sprint(now + SECONDS_PER_YEAR), "250", "8000")
+	c.must_invoke(LEASER, "terminate_lease", "L2")
+	c.must_fail("Permission Denied", ANDREW, "activate_lease", "L2")
+}
+
+//==============================================================================================================================
+//	 Lifecycle
+//==============================================================================================================================
+func TestLifecycle(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, LEASER, SCRAPPER)
+
+	var l Lifecycle
+
+	c.must_query(&l, JOE, "get_lifecycle")
+
+	check(t, "transitions", len(l.Transitions), len(lifecycle))
+	check(t, "states", l.States[STATE_LEASE_OWNERSHIP], "lease_ownership")
+
+	c.must_invoke(DVLA, "create_vehicle", "AB0000001")
+	c.transfer(DVLA, "authority_to_manufacturer", JLR, "AB0000001")
+	c.must_fail("Car not fully defined", JLR, "manufacturer_to_private", DEALER, "AB0000001")
+
+	c.sell_vehicle("AB0000002", test_vins[1], "CD34EFG")
+
+	c.transfer(DEALER, "private_to_lease_company", LEASER, "AB0000002")
+	check(t, "sold to lease company", c.vehicle("AB0000002").Status, STATE_LEASE_OWNERSHIP)
+
+	c.must_fail("Permission Denied", LEASER, "private_to_private", JOE, "AB0000002")
+
+	c.transfer(LEASER, "lease_company_to_private", JOE, "AB0000002")
+	check(t, "sold by lease company", c.vehicle("AB0000002").Status, STATE_PRIVATE_OWNERSHIP)
+
+	c.must_fail("Permission Denied", JOE, "lease_company_to_private", DEALER, "AB0000002")
+
+	c.transfer(JOE, "private_to_scrap_merchant", SCRAPPER, "AB0000002")
+	check(t, "scrapped", c.vehicle("AB0000002").Status, STATE_BEING_SCRAPPED)
+}
+
+//==============================================================================================================================
+//	 Transfer recipients
+//==============================================================================================================================
+func TestTransferRecipients(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, SCRAPPER)
+
+	c.must_invoke(DVLA, "create_vehicle", "AB0000001")
+
+	c.must_fail("Unknown recipient", DVLA, "authority_to_manufacturer", "Nobody", "AB0000001")
+	c.must_fail("Permission Denied", DVLA, "authority_to_manufacturer", JOE, "AB0000001")		// The recipient's registered role decides, not the name
+
+	c.sell_vehicle("AB0000002", test_vins[1], "CD34EFG")
+
+	c.must_fail("Permission Denied", DEALER, "private_to_private", SCRAPPER, "AB0000002")
+	c.must_fail("Permission Denied", JOE, "private_to_private", DEALER, "AB0000002")
+	c.transfer(DEALER, "private_to_private", JOE, "AB0000002")
+
+	check(t, "owner", c.vehicle("AB0000002").Owner, JOE)
+}
+
+func TestParticipantRegistry(t *testing.T) {
+
+	c := new_test_chain(t, JLR, BMW, DEALER, JOE)
+
+	c.must_invoke(DVLA, "update_participant", DEALER, `{"address":["1 High Street"], "postcode":"AB1 2CD"}`)
+
+	var manufacturers, dealerships, registry []Participant
+
+	c.must_query(&manufacturers, JOE, "get_participants", MANUFACTURER)
+	c.must_query(&dealerships, JOE, "get_participants", PRIVATE_ENTITY, DEALERSHIP)
+	c.must_query(&registry, DVLA, "get_participants", PRIVATE_ENTITY, DEALERSHIP)
+
+	check(t, "manufacturers", len(manufacturers), 2)
+	check(t, "dealership", dealerships, []Participant{{Identity: DEALER, Role: PRIVATE_ENTITY, Type: DEALERSHIP, Name: DEALER}})
+	check(t, "registry", []interface{}{registry[0].Postcode, registry[0].Status}, []interface{}{"AB1 2CD", PARTICIPANT_ACTIVE})
+
+	c.must_fail("Permission Denied", JLR, "register_participant", `{"identity":"Someone", "role":"private"}`)
+	c.must_fail("Invalid identity or role", DVLA, "register_participant", `{"identity":"Someone", "role":"pirate"}`)
+	c.must_fail("already exists", DVLA, "register_participant", `{"identity":"` + JOE + `", "role":"private"}`)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	c.must_invoke(DVLA, "suspend_participant", JOE)
+	c.must_fail("is suspended", DEALER, "private_to_private", JOE, "AB0000001")
+
+	c.must_fail("Permission Denied", JOE, "update_participant", JOE, `{"status":"active"}`)
+	c.must_invoke(DVLA, "update_participant", JOE, `{"status":"active"}`)
+	c.transfer(DEALER, "private_to_private", JOE, "AB0000001")
+}
+
+func TestTransferOffers(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, ANDREW)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	var offered Transfer_Result
+
+	json.Unmarshal(c.must_invoke(DEALER, "offer_transfer", "AB0000001", JOE, "private_to_private"), &offered)
+
+	check(t, "offer", offered.Result, "offered")
+	check(t, "owner until accepted", c.vehicle("AB0000001").Owner, DEALER)
+
+	c.must_fail("already has a pending offer", DEALER, "offer_transfer", "AB0000001", ANDREW, "private_to_private")
+
+	var joes, andrews []Transfer_Offer
+
+	c.must_query(&joes, JOE, "get_pending_offers")
+	c.must_query(&andrews, ANDREW, "get_pending_offers")
+
+	check(t, "offers to Joe", len(joes), 1)
+	check(t, "offers to Andrew", len(andrews), 0)
+
+	c.must_fail("Permission Denied", ANDREW, "accept_transfer", "AB0000001")
+
+	var accepted []Transfer_Result
+
+	json.Unmarshal(c.must_invoke(JOE, "accept_transfer", "AB0000001"), &accepted)
+
+	check(t, "accepted", accepted[0].Result, "transferred")
+	check(t, "owner", c.vehicle("AB0000001").Owner, JOE)
+
+	json.Unmarshal(c.must_invoke(JOE, "private_to_private", ANDREW, "AB0000001"), &offered)		// A lifecycle transfer is an offer too
+
+	check(t, "lifecycle transfer", offered.Result, "offered")
+	check(t, "owner until the transfer is accepted", c.vehicle("AB0000001").Owner, JOE)
+
+	c.must_invoke(ANDREW, "reject_transfer", "AB0000001")
+	c.must_fail("No pending offer", ANDREW, "accept_transfer", "AB0000001")
+
+	c.must_invoke(JOE, "offer_transfer", "AB0000001", ANDREW, "private_to_private")
+	c.must_fail("Permission Denied", ANDREW, "cancel_offer", "AB0000001")
+	c.must_invoke(JOE, "cancel_offer", "AB0000001")
+	c.must_fail("No pending offer", ANDREW, "accept_transfer", "AB0000001")
+
+	c.must_invoke(JOE, "private_to_private", ANDREW, "AB0000001", fmt.Sprint(c.stub.now + 60))
+	c.stub.now += 120
+	c.must_fail("No pending offer", ANDREW, "accept_transfer", "AB0000001")
+
+	c.must_fail("Unknown transfer type", JOE, "offer_transfer", "AB0000001", ANDREW, "private_to_nowhere")
+	c.must_fail("Invalid expiry", JOE, "offer_transfer", "AB0000001", ANDREW, "private_to_private", fmt.Sprint(c.stub.now))
+}
+
+func TestTransferVehicles(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+	c.sell_vehicle("AB0000002", test_vins[1], "CD34EFG")
+
+	var results []Transfer_Result
+
+	bytes, err := c.invoke(DEALER, "transfer_vehicles", "private_to_private", JOE, `["AB0000001", "AB0000002", "AB0000009"]`)
+
+	json.Unmarshal(bytes, &results)
+
+	check(t, "failed batch", err.Error(), "TRANSFER_VEHICLES: No vehicles offered")
+	check(t, "failed results", []string{results[0].Result, results[1].Result, results[2].Result}, []string{"offered", "offered", "rejected"})
+
+	bytes, _ = c.invoke(DEALER, "transfer_vehicles", "private_to_private", JOE, `["AB0000001", "AB0000001"]`)
+
+	json.Unmarshal(bytes, &results)
+
+	check(t, "vehicle listed twice", results[1].Error, "Vehicle AB0000001 listed more than once")
+
+	var offers []Transfer_Offer
+
+	c.must_query(&offers, JOE, "get_pending_offers")
+
+	check(t, "offers after failed batch", len(offers), 0)
+
+	json.Unmarshal(c.must_invoke(DEALER, "transfer_vehicles", "private_to_private", JOE, `["AB0000001", "AB0000002"]`), &results)
+
+	check(t, "results", []string{results[0].Result, results[1].Result}, []string{"offered", "offered"})
+	check(t, "owner until accepted", c.vehicle("AB0000001").Owner, DEALER)
+
+	c.must_invoke(JOE, "accept_transfer", "AB0000002")							// Accepting one vehicle accepts the batch
+
+	check(t, "first owner", c.vehicle("AB0000001").Owner, JOE)
+	check(t, "second owner", c.vehicle("AB0000002").Owner, JOE)
+
+	e := c.event()
+
+	check(t, "event", []interface{}{e.Type, len(e.Changes)}, []interface{}{EVENT_VEHICLE_TRANSFERRED, 2})
+}
+
+func TestUpdateVehicle(t *testing.T) {
+
+	c := new_test_chain(t, JLR, JOE)
+
+	c.must_invoke(DVLA, "create_vehicle", "AB0000001")
+	c.transfer(DVLA, "authority_to_manufacturer", JLR, "AB0000001")
+
+	c.must_fail("colour: Permission denied", JOE, "update_vehicle", "AB0000001", `{"colour":"Blue"}`)
+	c.must_fail("engine: Unknown field", JLR, "update_vehicle", "AB0000001", `{"colour":"Blue", "engine":"V8"}`)
+	c.must_fail("model: No type approval", JLR, "update_vehicle", "AB0000001", `{"make":"Jaguar", "model":"XJ"}`)
+	c.must_fail("Invalid value for colour", JLR, "update_vehicle", "AB0000001", `{"colour":true}`)
+	c.must_fail("Invalid patch", JLR, "update_vehicle", "AB0000001", `{}`)
+
+	v := c.vehicle("AB0000001")
+
+	check(t, "rejected patches", []interface{}{v.Make, v.Colour}, []interface{}{"UNDEFINED", "UNDEFINED"})
+
+	c.must_invoke(JLR, "update_vehicle", "AB0000001", `{"VIN":"` + test_vins[0] + `", "make":"Jaguar", "model":"F-Type", "reg":"ab12 cde", "colour":"Red"}`)
+	c.must_invoke(JLR, "update_colour", "Blue", "AB0000001")
+
+	v = c.vehicle("AB0000001")
+
+	check(t, "patched", []interface{}{v.VIN, v.WMI, v.Make, v.Model, v.Reg, v.Colour}, []interface{}{test_vins[0], "SAJ", "Jaguar", "F-Type", "AB12CDE", "Blue"})
+}
+
+func TestMigrateIndex(t *testing.T) {
+
+	c := new_test_chain(t, JOE)
+
+	c.stub.MockTransactionStart("legacy")												// Written as the chaincode before the key prefixes
+	c.stub.PutState("AB0000009", []byte(`{"v5cID":"AB0000009", "VIN":12345, "make":"Ford", "model":"Fiesta", "reg":"UNDEFINED", "owner":"` + JOE + `", "colour":"Blue", "leaseContractID":"UNDEFINED", "status":2, "scrapped":false}`))
+	c.stub.PutState("v5cIDs", []byte(`{"v5cs":["AB0000009"]}`))
+	c.stub.MockTransactionEnd("legacy")
+
+	c.must_fail("Permission Denied", JOE, "migrate_index")
+
+	check(t, "migrated", string(c.must_invoke(DVLA, "migrate_index")), "1")
+
+	v := c.vehicle("AB0000009")
+
+	check(t, "migrated vehicle", []interface{}{v.Owner, v.VIN}, []interface{}{JOE, "12345"})
+
+	_, ids := c.vehicle_page(JOE, "get_vehicles_by_owner", JOE)
+
+	check(t, "owner index", ids, []string{"AB0000009"})
+
+	c.must_fail("Nothing to migrate", DVLA, "migrate_index")
+}
+
+func TestGetVehicles(t *testing.T) {
+
+	c := new_test_chain(t, JLR)
+
+	for i := 1; i <= 5; i++ { c.must_invoke(DVLA, "create_vehicle", fmt.Sprintf("AB000000%d", i)) }
+
+	first, ids := c.vehicle_page(DVLA, "get_vehicles", "", "2")
+
+	check(t, "first page", ids, []string{"AB0000001", "AB0000002"})
+	check(t, "first bookmark", first.Next, "vehicle_AB0000003")
+	check(t, "no total unless asked", first.Total == nil, true)
+
+	second, ids := c.vehicle_page(DVLA, "get_vehicles", "", "2", first.Next)
+
+	check(t, "second page", ids, []string{"AB0000003", "AB0000004"})
+
+	last, ids := c.vehicle_page(DVLA, "get_vehicles", "", "2", second.Next)
+
+	check(t, "last page", ids, []string{"AB0000005"})
+	check(t, "last bookmark", last.Next, "")
+
+	counted, _ := c.vehicle_page(DVLA, "get_vehicles", "", "2", "", "true")
+
+	check(t, "total", *counted.Total, 5)
+
+	c.transfer(DVLA, "authority_to_manufacturer", JLR, "AB0000002")
+
+	_, ids = c.vehicle_page(DVLA, "get_vehicles", `{"status":1}`)
+
+	check(t, "filtered", ids, []string{"AB0000002"})
+
+	_, ids = c.vehicle_page(JLR, "get_vehicles", "")
+
+	check(t, "readable by manufacturer", ids, []string{"AB0000002"})
+
+	by_owner, ids := c.vehicle_page(DVLA, "get_vehicles_by_owner", DVLA, "3", "", "true")
+
+	check(t, "by owner", ids, []string{"AB0000001", "AB0000003", "AB0000004"})
+	check(t, "by owner bookmark", by_owner.Next, "owner_DVLA_AB0000005")
+	check(t, "by owner total", *by_owner.Total, 4)
+
+	c.query_fails("Invalid page size", DVLA, "get_vehicles", "", "0")
+	c.query_fails("Invalid filter", DVLA, "get_vehicles", "{")
+}
+
+func TestLookupIndexes(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	var by_vin, by_reg Vehicle
+
+	c.must_query(&by_vin, DEALER, "get_vehicle_by_vin", strings.ToLower(test_vins[0]))
+	c.must_query(&by_reg, DEALER, "get_vehicle_by_reg", "ab12 cde")
+
+	check(t, "by VIN", by_vin.V5cID, "AB0000001")
+	check(t, "by registration", by_reg.V5cID, "AB0000001")
+
+	c.query_fails("Permission Denied", JOE, "get_vehicle_by_vin", test_vins[0])
+
+	c.must_invoke(DVLA, "create_vehicle", "AB0000002")
+	c.transfer(DVLA, "authority_to_manufacturer", JLR, "AB0000002")
+
+	c.must_fail("VIN already registered to another vehicle", JLR, "update_vin", test_vins[0], "AB0000002")
+	c.must_fail("has already been issued", JLR, "update_reg", "AB12 CDE", "AB0000002")
+}
+
+func TestVINValidation(t *testing.T) {
+
+	cc := new(SimpleChaincode)
+
+	check(t, "check digit X", cc.validate_vin("1M8GDM9AXKP042788"), nil)
+
+	c := new_test_chain(t, JLR, BMW)
+
+	c.must_invoke(DVLA, "create_vehicle", "AB0000001")
+	c.transfer(DVLA, "authority_to_manufacturer", JLR, "AB0000001")
+
+	c.must_fail("Invalid check digit", JLR, "update_vin", "SAJAA4DA11V000001", "AB0000001")
+	c.must_fail("Invalid value passed for new VIN", JLR, "update_vin", "SAJAA4DA9IV000001", "AB0000001")
+	c.must_fail("Invalid value passed for new VIN", JLR, "update_vin", "SAJ123", "AB0000001")
+	c.must_fail("WMI WBA is not registered to " + JLR, JLR, "update_vin", BMW_VIN, "AB0000001")
+
+	c.must_invoke(JLR, "update_vin", strings.ToLower(test_vins[0]), "AB0000001")
+
+	v := c.vehicle("AB0000001")
+
+	check(t, "VIN", []interface{}{v.VIN, v.WMI}, []interface{}{test_vins[0], "SAJ"})
+
+	c.must_fail("Permission denied", JLR, "update_vin", test_vins[1], "AB0000001")		// Only set once
+}
+
+func TestEvents(t *testing.T) {
+
+	c := new_test_chain(t, JLR, BMW, JOE)
+
+	c.must_invoke(DVLA, "create_vehicle", "AB0000001")
+
+	e := c.event()
+
+	check(t, "created", []interface{}{e.Version, e.Type, e.TxID, len(e.Changes), e.Changes[0].NewOwner}, []interface{}{EVENT_VERSION, EVENT_VEHICLE_CREATED, c.stub.GetTxID(), 1, DVLA})
+
+	c.must_invoke(DVLA, "authority_to_manufacturer", JLR, "AB0000001")
+
+	check(t, "events for an offer", len(c.stub.events), 0)
+
+	c.must_invoke(JLR, "accept_transfer", "AB0000001")
+
+	e = c.event()
+
+	check(t, "transferred", []interface{}{e.Type, e.Changes[0].PreviousOwner, e.Changes[0].NewOwner, e.Changes[0].NewStatus}, []interface{}{EVENT_VEHICLE_TRANSFERRED, DVLA, JLR, STATE_MANUFACTURE})
+
+	c.must_invoke(JLR, "update_colour", "Red", "AB0000001")
+
+	e = c.event()
+
+	check(t, "updated", []interface{}{e.Type, e.Changes[0].ChangedFields}, []interface{}{EVENT_VEHICLE_UPDATED, []string{"colour"}})
+
+	c.must_fail("Permission denied", JOE, "update_colour", "Blue", "AB0000001")
+
+	check(t, "events for a failed invoke", len(c.stub.events), 0)
+
+	c.must_invoke(DVLA, "approve_type", BMW, "BMW", "M3", "e1*2007/46*0002")
+
+	check(t, "events when no vehicle changes", len(c.stub.events), 0)
+}
+
+func TestFreezeVehicle(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, ANDREW, OFFICER)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+	c.must_invoke(DEALER, "offer_transfer", "AB0000001", JOE, "private_to_private")
+
+	c.must_fail("Permission Denied", JOE, "freeze_vehicle", "AB0000001", "FRAUD", "CASE1")
+	c.must_invoke(DVLA, "freeze_vehicle", "AB0000001", "FRAUD", "CASE1")
+
+	check(t, "event", c.event().Type, EVENT_VEHICLE_FROZEN)
+
+	c.must_fail("is frozen", DEALER, "private_to_private", ANDREW, "AB0000001")
+	c.must_fail("is frozen", JOE, "accept_transfer", "AB0000001")
+	c.must_fail("is frozen", DEALER, "record_odometer", "AB0000001", "100", "service")
+	c.must_fail("is frozen", DEALER, "retain_plate", "AB0000001")
+	c.must_fail("already under freeze", DVLA, "freeze_vehicle", "AB0000001", "FRAUD", "CASE2")
+
+	c.must_invoke(OFFICER, "report_stolen", "AB0000001", "CR1")					// The police can still report a frozen vehicle stolen and recovered
+	c.must_invoke(OFFICER, "mark_recovered", "AB0000001")
+
+	c.must_invoke(JOE, "reject_transfer", "AB0000001")							// Leaves the vehicle as it is
+
+	c.must_fail("frozen under case CASE1", DVLA, "unfreeze_vehicle", "AB0000001", "CASE2")
+	c.must_invoke(DVLA, "unfreeze_vehicle", "AB0000001", "CASE1")
+
+	c.must_invoke(DVLA, "seize_vehicle", "AB0000001", "CRIME", "CASE3")
+
+	v := c.vehicle("AB0000001")
+
+	check(t, "seized", []interface{}{v.Owner, v.Frozen, v.Enforcement.PreviousOwner}, []interface{}{DVLA, true, DEALER})
+
+	c.must_invoke(DVLA, "unfreeze_vehicle", "AB0000001", "CASE3")
+
+	v = c.vehicle("AB0000001")
+
+	check(t, "released", []interface{}{v.Owner, v.Frozen}, []interface{}{DEALER, false})
+
+	c.transfer(DEALER, "private_to_private", JOE, "AB0000001")
+}
+
+func TestStolenVehicles(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, OFFICER)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	c.must_fail("Permission Denied", JOE, "report_stolen", "AB0000001", "CR1")
+	c.must_invoke(OFFICER, "report_stolen", "AB0000001", "CR1")
+
+	var stolen Stolen_Check
+
+	c.must_query(&stolen, JOE, "check_stolen", "AB0000001")
+
+	check(t, "stolen", []interface{}{stolen.Stolen, stolen.Reported}, []interface{}{true, int64(TEST_START)})
+
+	c.must_fail("reported stolen", DEALER, "private_to_private", JOE, "AB0000001")
+	c.must_fail("already reported stolen", DEALER, "report_stolen", "AB0000001", "CR2")
+	c.must_fail("Permission Denied", DEALER, "mark_recovered", "AB0000001")
+
+	c.must_invoke(OFFICER, "mark_recovered", "AB0000001")
+
+	var recovered Stolen_Check
+
+	c.must_query(&recovered, JOE, "check_stolen", "AB0000001")
+
+	check(t, "recovered", recovered.Stolen, false)
+
+	c.transfer(DEALER, "private_to_private", JOE, "AB0000001")
+}
+
+func TestOdometerReadings(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, ANDREW)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+	c.transfer(DEALER, "private_to_private", JOE, "AB0000001")
+
+	c.must_fail("Permission Denied", ANDREW, "record_odometer", "AB0000001", "1000", "sale")
+	c.must_invoke(JOE, "record_odometer", "AB0000001", "1000", "service")
+	c.must_invoke(DEALER, "record_odometer", "AB0000001", "100000", "service")		// Any dealership can record a reading
+
+	check(t, "no discrepancy", c.vehicle("AB0000001").MileageDiscrepancy, false)
+
+	c.must_invoke(JOE, "record_odometer", "AB0000001", "1100", "service")			// Lower than the last reading
+
+	v := c.vehicle("AB0000001")
+
+	check(t, "rolled back", []interface{}{v.Mileage, v.MileageDiscrepancy}, []interface{}{100000, true})
+
+	c.must_fail("Permission Denied", JOE, "mark_odometer_erroneous", "AB0000001", "1")
+	c.must_invoke(DVLA, "mark_odometer_erroneous", "AB0000001", "1")
+
+	v = c.vehicle("AB0000001")
+
+	check(t, "corrected", []interface{}{v.Mileage, v.MileageDiscrepancy}, []interface{}{1100, true})
+
+	c.must_invoke(JOE, "record_odometer", "AB0000001", "1200", "service")
+
+	var h Odometer_History
+
+	c.must_query(&h, JOE, "get_odometer_history", "AB0000001")
+
+	check(t, "readings", []interface{}{len(h.Readings), h.Readings[1].Erroneous, h.MileageDiscrepancy}, []interface{}{4, true, true})
+	check(t, "mileage", c.vehicle("AB0000001").Mileage, 1200)
+}
+
+func TestInspections(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, ANDREW, GARAGE)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	c.must_fail("Permission Denied", JOE, "set_inspection_policy", "3")
+	c.must_invoke(DVLA, "set_inspection_policy", "3")
+	c.transfer(DEALER, "private_to_private", JOE, "AB0000001")					// Too young to need an inspection
+
+	c.stub.now += 4 * SECONDS_PER_YEAR
+
+	c.must_fail("needs a valid inspection", JOE, "private_to_private", ANDREW, "AB0000001")
+
+	expiry := fmt.Sprint(c.stub.now + SECONDS_PER_YEAR)
+
+	c.must_fail("Permission Denied", JOE, "record_inspection", "AB0000001", "pass", expiry, "[]", "[]")
+	c.must_fail("must list the failure items", GARAGE, "record_inspection", "AB0000001", "fail", expiry, "[]", "[]")
+
+	c.must_invoke(GARAGE, "record_inspection", "AB0000001", "fail", expiry, "[]", `["brakes"]`)
+	c.must_fail("needs a valid inspection", JOE, "private_to_private", ANDREW, "AB0000001")
+
+	c.must_invoke(GARAGE, "record_inspection", "AB0000001", "pass", expiry, `["tyres"]`, "[]", "42000")
+
+	check(t, "inspection mileage", c.vehicle("AB0000001").Mileage, 42000)
+
+	c.transfer(JOE, "private_to_private", ANDREW, "AB0000001")
+
+	var h Inspection_History
+
+	c.must_query(&h, GARAGE, "get_inspections", "AB0000001")
+
+	check(t, "inspections", len(h.Inspections), 2)
+}
+
+func TestRecalls(t *testing.T) {
+
+	c := new_test_chain(t, JLR, BMW, DEALER, JOE)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+	c.sell_vehicle("AB0000002", test_vins[1], "CD34EFG")
+
+	c.must_fail("Permission Denied", DEALER, "issue_recall", "R1", "Jaguar", "F-Type", "Airbag inflator", `["` + test_vins[0] + `"]`)
+	c.must_fail("No vehicles of yours match", BMW, "issue_recall", "R1", "Jaguar", "F-Type", "Airbag inflator", `["` + test_vins[0] + `"]`)
+
+	c.stub.broken = "recall_R1"
+	c.must_fail("Unable to look up recall R1", JLR, "issue_recall", "R1", "Jaguar", "F-Type", "Airbag inflator", `["` + test_vins[0] + `"]`)
+	c.stub.broken = "vin_" + test_vins[0]
+	c.must_fail("Unable to look up VIN " + test_vins[0], JLR, "issue_recall", "R1", "Jaguar", "F-Type", "Airbag inflator", `["` + test_vins[0] + `"]`)
+	c.stub.broken = ""
+
+	var r1, r2 Recall
+
+	json.Unmarshal(c.must_invoke(JLR, "issue_recall", "R1", "Jaguar", "F-Type", "Airbag inflator", `["` + test_vins[0] + `"]`), &r1)
+	json.Unmarshal(c.must_invoke(JLR, "issue_recall", "R2", "Jaguar", "F-Type", "Brake hose", test_vins[0], test_vins[2]), &r2)
+
+	sort.Strings(r2.Vehicles)														// In VIN order, which isn't serial number order
+
+	check(t, "listed VINs", r1.Vehicles, []string{"AB0000001"})
+	check(t, "VIN range", r2.Vehicles, []string{"AB0000001", "AB0000002"})
+
+	var offered Transfer_Result
+
+	json.Unmarshal(c.must_invoke(DEALER, "offer_transfer", "AB0000002", JOE, "private_to_private"), &offered)
+
+	check(t, "recalls shown to the buyer", len(offered.OpenRecalls), 1)
+
+	c.must_fail("not an active dealership", JOE, "remedy_recall", "AB0000001", "R1")
+	c.must_invoke(DEALER, "remedy_recall", "AB0000001", "R1")
+	c.must_fail("already been remedied", DEALER, "remedy_recall", "AB0000001", "R1")
+
+	var open Open_Recalls
+
+	c.must_query(&open, DEALER, "get_open_recalls", "AB0000001")
+
+	check(t, "open recalls", len(open.Recalls), 1)
+	check(t, "open recall", open.Recalls[0].RecallID, "R2")
+}
+
+func TestLiens(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, ANDREW, LEASER, BANK)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+	c.transfer(DEALER, "private_to_private", JOE, "AB0000001")
+
+	c.must_fail("Permission Denied", ANDREW, "register_lien", "AB0000001", "HP1", "500000")
+	c.must_fail("Permission Denied", LEASER, "register_lien", "AB0000001", "HP1", "500000")		// Only lenders register liens
+
+	c.stub.broken = "lien_AB0000001_HP1"
+	c.must_fail("Unable to look up lien HP1", BANK, "register_lien", "AB0000001", "HP1", "500000")
+	c.stub.broken = ""
+
+	c.must_invoke(BANK, "register_lien", "AB0000001", "HP1", "500000")
+
+	c.must_fail("outstanding finance", JOE, "private_to_private", ANDREW, "AB0000001")
+	c.must_fail("outstanding finance", JOE, "offer_transfer", "AB0000001", ANDREW, "private_to_private")
+
+	amounts := map[string]int{ANDREW: 0, JOE: 500000, BANK: 500000, DVLA: 500000}
+
+	for caller, amount := range amounts {
+
+		var f Finance_Check
+
+		c.must_query(&f, caller, "check_finance", "AB0000001")
+
+		check(t, "finance seen by " + caller, []interface{}{f.Financed, f.Liens[0].Lender, f.Liens[0].Amount}, []interface{}{true, BANK, amount})
+	}
+
+	c.must_fail("Permission Denied", JOE, "release_lien", "AB0000001", "HP1")
+	c.must_invoke(BANK, "release_lien", "AB0000001", "HP1")
+
+	var f Finance_Check
+
+	c.must_query(&f, ANDREW, "check_finance", "AB0000001")
+
+	check(t, "released", []interface{}{f.Financed, len(f.Liens)}, []interface{}{false, 0})
+
+	c.transfer(JOE, "private_to_private", ANDREW, "AB0000001")
+}
+
+func TestWriteOffs(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, SCRAPPER, INSURANCE)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	c.must_fail("Permission Denied", DEALER, "record_damage", "AB0000001", "Scratched door")
+	c.must_invoke(INSURANCE, "record_damage", "AB0000001", "Flood damage", "b")
+
+	check(t, "event", c.event().Type, EVENT_VEHICLE_WRITTEN_OFF)
+
+	c.must_fail("already a category B", INSURANCE, "record_damage", "AB0000001", "Repaired", "S")
+	c.must_fail("can only be scrapped", DEALER, "private_to_private", JOE, "AB0000001")
+
+	var h Damage_History
+
+	c.must_query(&h, INSURANCE, "get_damage_history", "AB0000001")
+
+	check(t, "damage", []interface{}{h.WriteOff, len(h.Events)}, []interface{}{WRITE_OFF_B, 1})
+
+	c.transfer(DEALER, "private_to_scrap_merchant", SCRAPPER, "AB0000001")
+}
+
+func TestKeepers(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, ANDREW)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	c.must_fail("Permission Denied", JOE, "assign_keeper", JOE, "AB0000001")
+	c.must_fail("Unknown keeper", DEALER, "assign_keeper", "Nobody", "AB0000001")
+	c.must_invoke(DEALER, "assign_keeper", JOE, "AB0000001")
+
+	c.must_query(nil, JOE, "get_vehicle_details", "AB0000001")
+	c.must_invoke(JOE, "tax_vehicle", "AB0000001", "6")
+
+	c.must_fail("Permission Denied", ANDREW, "release_keeper", "AB0000001")
+	c.must_invoke(JOE, "release_keeper", "AB0000001")
+
+	c.query_fails("Permission Denied", JOE, "get_vehicle_details", "AB0000001")
+	c.must_fail("has no keeper", DEALER, "release_keeper", "AB0000001")
+}
+
+func TestLogbooks(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE, ANDREW)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+
+	first := c.vehicle("AB0000001").Logbook
+
+	check(t, "issued to", first.IssuedTo, DEALER)
+
+	c.transfer(DEALER, "private_to_private", JOE, "AB0000001")
+
+	second := c.vehicle("AB0000001").Logbook
+
+	if second.DocumentRef == first.DocumentRef { t.Fatalf("logbook %s not replaced", first.DocumentRef) }
+
+	statuses := map[string]string{first.DocumentRef: LOGBOOK_SUPERSEDED, second.DocumentRef: LOGBOOK_CURRENT, "00000000000": LOGBOOK_UNKNOWN}
+
+	for ref, status := range statuses {
+
+		var l Logbook_Check
+
+		c.must_query(&l, ANDREW, "verify_logbook", "AB0000001", ref)
+
+		check(t, "logbook " + ref, []interface{}{l.Status, l.Current}, []interface{}{status, status == LOGBOOK_CURRENT})
+	}
+}
+
+func TestPlates(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+	c.sell_vehicle("AB0000002", test_vins[1], "CD34EFG")
+
+	c.must_fail("Permission Denied", JOE, "retain_plate", "AB0000001")
+	c.must_invoke(DEALER, "retain_plate", "AB0000001")
+
+	check(t, "retained from", c.vehicle("AB0000001").Reg, "UNDEFINED")
+
+	c.must_fail("Permission denied", DEALER, "update_reg", "XY99XYZ", "AB0000001")		// Only the regulator issues a new one
+
+	var p Plate
+
+	c.must_query(&p, DEALER, "get_plate", "ab12 cde")
+
+	check(t, "retained", []interface{}{p.Status, p.Certificate.Holder, p.Certificate.Expiry}, []interface{}{PLATE_RETAINED, DEALER, int64(TEST_START + RETENTION_YEARS * SECONDS_PER_YEAR)})
+
+	c.query_fails("Permission Denied", JOE, "get_plate", "AB12CDE")
+	c.query_fails("No vehicle found", DVLA, "get_vehicle_by_reg", "AB12CDE")
+
+	c.must_invoke(DVLA, "create_vehicle", "AB0000003")
+	c.transfer(DVLA, "authority_to_manufacturer", JLR, "AB0000003")
+	c.must_fail("has already been issued", JLR, "update_reg", "AB12CDE", "AB0000003")		// A retained registration stays issued
+
+	c.must_invoke(DEALER, "transfer_plate", "AB12CDE", "AB0000002")			// Its own plate goes onto a certificate
+
+	check(t, "plate moved", c.vehicle("AB0000002").Reg, "AB12CDE")
+
+	var by_reg Vehicle
+	var old Plate
+
+	c.must_query(&by_reg, DEALER, "get_vehicle_by_reg", "AB12CDE")
+	c.must_query(&old, DEALER, "get_plate", "CD34EFG")
+
+	check(t, "by registration", by_reg.V5cID, "AB0000002")
+	check(t, "old plate", old.Status, PLATE_RETAINED)
+
+	c.must_invoke(DEALER, "transfer_plate", "AB12CDE", "AB0000001")			// Straight from one vehicle to another
+
+	check(t, "moved between vehicles", []interface{}{c.vehicle("AB0000001").Reg, c.vehicle("AB0000002").Reg}, []interface{}{"AB12CDE", "UNDEFINED"})
+
+	c.must_fail("Permission Denied", JOE, "transfer_plate", "CD34EFG", "AB0000002")
+	c.must_fail("has not been issued", DEALER, "transfer_plate", "ZZ99ZZZ", "AB0000002")
+
+	c.stub.now += (RETENTION_YEARS + 1) * SECONDS_PER_YEAR
+
+	c.must_fail("has expired", DEALER, "transfer_plate", "CD34EFG", "AB0000002")
+}
+
+func TestTaxAndSORN(t *testing.T) {
+
+	c := new_test_chain(t, JLR, DEALER, JOE)
+
+	c.sell_vehicle("AB0000001", test_vins[0], "AB12CDE")
+	c.sell_vehicle("AB0000002", test_vins[1], "CD34EFG")
+	c.build_vehicle("AB0000003", test_vins[2], "EF56GHJ")						// Not on the road yet
+
+	untaxed, ids := c.vehicle_page(DVLA, "get_untaxed_vehicles", "1", "", "true")
+
+	check(t, "untaxed", ids, []string{"AB0000001"})
+	check(t, "untaxed bookmark", untaxed.Next, "vehicle_AB0000002")
+	check(t, "untaxed total", *untaxed.Total, 2)
+
+	c.query_fails("Permission Denied", DEALER, "get_untaxed_vehicles")
+
+	c.must_fail("Invalid number of months", DEALER, "tax_vehicle", "AB0000001", "13")
+	c.must_fail("Permission Denied", JOE, "tax_vehicle", "AB0000001", "6")
+	c.must_invoke(DEALER, "tax_vehicle", "AB0000001", "12")
+
+	v := c.vehicle("AB0000001")
+
+	check(t, "taxed", []interface{}{v.TaxStatus, v.TaxedUntil}, []interface{}{TAX_TAXED, time.Unix(TEST_START, 0).UTC().AddDate(1, 0, 0).Unix()})
+
+	c.must_invoke(DEALER, "declare_sorn", "AB0000002")
+	c.must_fail("already declared off the road", DEALER, "declare_sorn", "AB0000002")
+
+	_, ids = c.vehicle_page(DVLA, "get_untaxed_vehicles")
+
+	check(t, "none untaxed", ids, []string{})
+
+	c.stub.now += 2 * SECONDS_PER_YEAR
+
+	check(t, "tax run out", c.vehicle("AB0000001").TaxStatus, TAX_UNTAXED)
+
+	c.transfer(DEALER, "private_to_private", JOE, "AB0000002")				// SORN doesn't pass to the new owner
+
+	check(t, "new owner", c.vehicle("AB0000002").TaxStatus, TAX_UNTAXED)
+
+	_, ids = c.vehicle_page(DVLA, "get_untaxed_vehicles")
+
+	check(t, "untaxed again", ids, []string{"AB0000001", "AB0000002"})
+}
+
+func TestTypeApproval(t *testing.T) {
+
+	c := new_test_chain(t, JLR, BMW, DEALER, JOE)
+
+	c.must_fail("Permission Denied", JLR, "approve_type", JLR, "Jaguar", "XE", "e11*2007/46*0002")
+	c.must_fail("is not a manufacturer", DVLA, "approve_type", JOE, "Jaguar", "XE", "e11*2007/46*0002")
+	c.must_fail("has already been issued", DVLA, "approve_type", JLR, "Jaguar", "XE", TEST_APPROVAL)
+	c.must_invoke(DVLA, "approve_type", BMW, "BMW", "M3", "e1*2007/46*0003")
+
+	c.must_invoke(DVLA, "create_vehicle", "AB0000001")
+	c.transfer(DVLA, "authority_to_manufacturer", JLR, "AB0000001")
+
+	c.must_fail("No type approval", JLR, "update_make", "Land Rover", "AB0000001")
+	c.must_invoke(JLR, "update_make", "Jaguar", "AB0000001")					// Any approved model of the make until the model is set
+	c.must_fail("No type approval", JLR, "update_model", "XE", "AB0000001")
+	c.must_invoke(JLR, "update_model", "F-Type", "AB0000001")
+	c.must_fail("No type approval", JLR, "update_make", "BMW", "AB0000001")		// Checked against the model already set
+	c.must_fail("No type approval", JLR, "update_vehicle", "AB0000001", `{"make":"BMW", "model":"M3"}`)
+
+	var approved Approved_Models
+
+	c.must_query(&approved, JLR, "get_approved_models")
+
+	check(t, "approved", len(approved.Approvals), 1)
+
+	c.query_fails("Permission Denied", JLR, "get_approved_models", BMW)
+
+	c.must_invoke(JLR, "update_vehicle", "AB0000001", `{"VIN":"` + test_vins[0] + `", "reg":"AB12CDE", "colour":"Red"}`)
+	c.must_invoke(DVLA, "withdraw_type_approval", TEST_APPROVAL)
+	c.must_fail("not in force", DVLA, "withdraw_type_approval", TEST_APPROVAL)
+	c.must_fail("No type approval", JLR, "manufacturer_to_private", DEALER, "AB0000001")
+
+	var withdrawn Approved_Models
+
+	c.must_query(&withdrawn, DVLA, "get_approved_models", JLR)
+
+	check(t, "withdrawn", len(withdrawn.Approvals), 0)
+}
@@ -190,6 +190,51 @@ function transferAsset()
     xhr.send(JSON.stringify(transferArray[transferIndex-1]));
 }
 
+function loadOffers() //Lists the transfers offered to the user, a vehicle only moves once its offer is accepted
+{
+    $.ajax({
+        type: 'GET',
+        dataType: 'json',
+        contentType: 'application/json',
+        crossDomain: true,
+        url: '/blockchain/assets/offers',
+        success: function(d) {
+
+            $('#offers').empty();
+
+            for(let i = 0; i < d.offers.length; i++)
+			{
+                let offer = d.offers[i];
+                $('#offers').append('<div class="offerRw" >'+offer.from+' has offered you vehicle '+offer.v5cID+'&nbsp;&nbsp;<span class="mnBtn" onclick="answerOffer(\''+offer.v5cID+'\', true)" >Accept</span>&nbsp;<span class="mnBtn" onclick="answerOffer(\''+offer.v5cID+'\', false)" >Reject</span></div>');
+            }
+        },
+        error: function(e)
+		{
+            console.log(e);
+        }
+    });
+}
+
+function answerOffer(v5cID, accept) //Accepts or rejects the offer of the vehicle, accepting makes the user its owner
+{
+    $.ajax({
+        type: 'PUT',
+        data: JSON.stringify({'accept': accept}),
+        dataType : 'json',
+        contentType: 'application/json',
+        crossDomain:true,
+        url: '/blockchain/assets/vehicles/'+v5cID+'/offer',
+        success: function(d) {
+            loadOffers();
+        },
+        error: function(e){
+            $('#fade').show();
+            $('#failTransfer').show();
+            $('#failTxt').html('Unable to '+(accept ? 'accept' : 'reject')+' the offer of vehicle '+v5cID+'.');
+        }
+    });
+}
+
 function scrapAssets(input)
 {
     scrapArray = input;
@@ -46,7 +46,7 @@ function loadAssets()
 					}
 					else
 					{
-						if(typeof obj.message == 'undefined' && obj.VIN > 0 && obj.make.toLowerCase() != 'undefined' && obj.make.trim() != '' && obj.model.toLowerCase() != 'undefined' && obj.model.trim() != '' && obj.reg.toLowerCase() != 'undefined' && obj.reg.trim() != '' && obj.colour.toLowerCase() != 'undefined' && obj.colour.trim() != '' && !obj.scrapped)
+						if(typeof obj.message == 'undefined' && obj.VIN != '' && obj.make.toLowerCase() != 'undefined' && obj.make.trim() != '' && obj.model.toLowerCase() != 'undefined' && obj.model.trim() != '' && obj.reg.toLowerCase() != 'undefined' && obj.reg.trim() != '' && obj.colour.toLowerCase() != 'undefined' && obj.colour.trim() != '' && !obj.scrapped)
 						{
 							objects.push(obj)
 						}
@@ -139,7 +139,7 @@ function loadUpdateAssets()
 			for(var i = 0; i < d.length; i++)
 			{
 				var data = d[i];
-				if(data.VIN == 0) data.VIN = '&lt;<i>VIN</i>&gt;';
+				if(data.VIN == '') data.VIN = '&lt;<i>VIN</i>&gt;';
 				if(data.make.toLowerCase() == 'undefined' || data.make.trim() == '') data.make = '&lt;<i>make</i>&gt;';
 				if(data.model.toLowerCase() == 'undefined' || data.model.trim() == '') data.model = '&lt;<i>model</i>&gt;';
 				if(data.reg.toLowerCase() == 'undefined' || data.reg.trim() == '') data.reg = '&lt;<i>registration</i>&gt;';
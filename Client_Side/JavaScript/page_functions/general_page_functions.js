@@ -34,6 +34,10 @@ $(document).ready(function(){
         }
     }
     getAltUsers();
+    if($('#offers').length)
+	{
+        loadOffers();
+    }
 });
 
 function getAltUsers()
@@ -82,6 +86,10 @@ function changeUser(company, parent, pos)
         url: '/admin/identity',
         success: function(d) {
             $('#selVhclsTbl').empty();
+            if($('#offers').length)
+			{
+                loadOffers();
+            }
             console.log(getCookie('user'));
         },
         error: function(e){
@@ -59,8 +59,13 @@ $(document).ready(function(){
 
                 let v5cID = $(this).find('.v5cID').val();
 
-                $('#chooseConfHd').html('<span>Transaction Complete</span>');
-                $('#confTxt').html('Transaction committed to the blockchain. <br /><br />Manufacturer: '+getCookie('user')+'<br /><br />'+recDets+': '+$('.delName').html()+' (Account '+$('.accAddr').html()+')<br /><br />Vehicles: '+$('#selVhclsTbl tr').length);
+                if(transferName === 'assign_keeper') { //Assigning a keeper takes effect at once, a transfer waits for the recipient to accept
+                    $('#chooseConfHd').html('<span>Transaction Complete</span>');
+                    $('#confTxt').html('Transaction committed to the blockchain. <br /><br />Manufacturer: '+getCookie('user')+'<br /><br />'+recDets+': '+$('.delName').html()+' (Account '+$('.accAddr').html()+')<br /><br />Vehicles: '+$('#selVhclsTbl tr').length);
+                } else {
+                    $('#chooseConfHd').html('<span>Transfer Offered</span>');
+                    $('#confTxt').html('Transfer offered on the blockchain, the vehicles move once the recipient accepts. <br /><br />Manufacturer: '+getCookie('user')+'<br /><br />'+recDets+': '+$('.delName').html()+' (Account '+$('.accAddr').html()+')<br /><br />Vehicles: '+$('#selVhclsTbl tr').length);
+                }
 
                 let data = {}; //Data to be sent
                 data.function_name= transferName; //E.g. manufacturer_to_private
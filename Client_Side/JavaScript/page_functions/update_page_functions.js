@@ -34,7 +34,7 @@ function showEditTbl(el)
 	var vin = $(el).siblings('.carVin').html()
 	if(vin == '&lt;<i>VIN</i>&gt;')
 	{
-		vin = 0;
+		vin = '';
 	}
 	var make = $(el).siblings('.carMake').html()
 	if(make == '&lt;<i>make</i>&gt;')
@@ -86,20 +86,26 @@ function validate(el)
 	
 	$('#errorRw').html('<ul></ul>');
 	var failed = false;
-	if(isNaN(parseInt($('#vin').val().trim())))
+	var vin = $('#vin').val().trim().toUpperCase();
+	if(vin.length != 17 && vin != '')
 	{
-		$('#errorRw').find('ul').append('<li>VIN must be a number</li>')
+		
+		$('#errorRw').find('ul').append('<li>VIN must be 17 characters (Currently ' + vin.length + ' characters)</li>')
 		failed = true;
 	}
-	if($('#vin').val().trim().length != 15 && $('#vin').val().trim() != 0)
+	else if(!/^[A-HJ-NPR-Z0-9]{17}$/.test(vin) && vin != '')
 	{
-		
-		$('#errorRw').find('ul').append('<li>VIN must be 15 characters (Currently ' + $('#vin').val().trim().length + ' characters)</li>')
+		$('#errorRw').find('ul').append('<li>VIN can only contain letters and numbers, excluding I, O and Q</li>')
 		failed = true;
 	}
-	if($('#vin').val().trim() == 0 && $('#hidVin').val().trim() != 0)
+	else if(vin != '' && vin.charAt(8) != vinCheckDigit(vin))
 	{
-		$('#errorRw').find('ul').append('<li>VIN cannot be reset to 0</li>')
+		$('#errorRw').find('ul').append('<li>VIN check digit (the 9th character) should be ' + vinCheckDigit(vin) + '</li>')
+		failed = true;
+	}
+	if(vin == '' && $('#hidVin').val().trim() != '')
+	{
+		$('#errorRw').find('ul').append('<li>VIN cannot be removed</li>')
 		failed = true;
 	}
 	if($('#make').val().trim() == '')
@@ -145,10 +151,29 @@ function validate(el)
 	if(!failed)
 	{
 		$('#errorRw').hide();
-		updateAsset($('#vin').val().trim(), $('#make').val().trim(), $('#model').val().trim(), $('#colour').val().trim(), $('#reg').val().trim().toUpperCase(), $('#v5cID').val(), el)
+		updateAsset(vin, $('#make').val().trim(), $('#model').val().trim(), $('#colour').val().trim(), $('#reg').val().trim().toUpperCase(), $('#v5cID').val(), el)
 	}
 	else
 	{
 		$('#errorRw').show();
 	}
 }
+
+function vinCheckDigit(vin)
+{
+	/*
+	Works out the ISO 3779 check digit of a VIN, the contract rejects VINs where the 9th character doesn't match it.
+	*/
+	
+	var letters = 'ABCDEFGHJKLMNPRSTUVWXYZ';
+	var values = '12345678123457923456789';
+	var weights = [8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2];
+	var sum = 0;
+	for(var i = 0; i < vin.length; i++)
+	{
+		var c = vin.charAt(i);
+		var value = letters.indexOf(c) != -1 ? parseInt(values.charAt(letters.indexOf(c))) : parseInt(c);
+		sum += value * weights[i];
+	}
+	return '0123456789X'.charAt(sum % 11);
+}
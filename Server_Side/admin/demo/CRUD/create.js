@@ -2,10 +2,13 @@
 
 const hfc = require('hfc');
 const Vehicle = require(__dirname+'/../../../tools/utils/vehicle');
+const Participant = require(__dirname+'/../../../tools/utils/participant');
+const Util = require(__dirname+'/../../../tools/utils/util');
 
 let tracing = require(__dirname+'/../../../tools/traces/trace.js');
 let map_ID = require(__dirname+'/../../../tools/map_ID/map_ID.js');
 let initial_vehicles = require(__dirname+'/../../../blockchain/assets/vehicles/initial_vehicles.js');
+let participants = require(__dirname+'/../../../blockchain/participants/participants_info.js');
 let fs = require('fs');
 
 const TYPES = [
@@ -17,6 +20,8 @@ const TYPES = [
 ];
 
 let vehicleData;
+let participantData;
+let regulatorSecurityContext;
 let v5cIDResults;
 
 function create(req, res, next, usersToSecurityContext) {
@@ -24,6 +29,11 @@ function create(req, res, next, usersToSecurityContext) {
         v5cIDResults = [];
         let chain = hfc.getChain('myChain');
         vehicleData = new Vehicle(usersToSecurityContext);
+        participantData = new Participant(usersToSecurityContext);
+        for(let group in participants) {
+            map_ID.load(participants[group]);
+        }
+        regulatorSecurityContext = usersToSecurityContext[map_ID.user_to_id('DVLA')];
 
         let cars;
         res.write(JSON.stringify({message:'Creating vehicles'})+'&&');
@@ -46,9 +56,17 @@ function create(req, res, next, usersToSecurityContext) {
         if(cars.hasOwnProperty('cars')) {
             tracing.create('INFO', 'Demo', 'Found cars');
             cars = cars.cars;
-            updateDemoStatus({message: 'Creating vehicles'});
+            updateDemoStatus({message: 'Registering participants'});
             // chain.getEventHub().connect();
-            return createVehicles(cars)
+            return registerParticipants()
+            .then(function() {
+                updateDemoStatus({message: 'Approving vehicle types'});
+                return approveTypes(cars);
+            })
+            .then(function() {
+                updateDemoStatus({message: 'Creating vehicles'});
+                return createVehicles(cars);
+            })
             .then(function() {
                 return v5cIDResults.reduce(function(prev, v5cID, index) {
                     let car = cars[index];
@@ -128,6 +146,52 @@ function transferBetweenOwners(v5cID, car, results) {
     }
 }
 
+// Adds every participant in participants_info to the registry on the ledger. Participants registered by an earlier
+// demo are already there so that error is ignored.
+function registerParticipants() {
+    let result = Promise.resolve();
+    for(let group in participants) {
+        participants[group].forEach(function(details) {
+            result = result.then(function() {
+                console.log('[#] Registering participant ' + details.identity);
+                return participantData.register(map_ID.user_to_id('DVLA'), group, details)
+                .catch(function(err) {
+                    if (JSON.stringify(err).indexOf('already exists') === -1) {
+                        throw err;
+                    }
+                });
+            });
+        });
+    }
+    return result;
+}
+
+// Approves the make and model of every car for the manufacturer that builds it, so it passes type approval when the
+// manufacturer sets them. The approval number is made from the type so a type approved by an earlier demo is skipped.
+function approveTypes(cars) {
+    let approved = {};
+    let result = Promise.resolve();
+    cars.forEach(function(car) {
+        let manufacturer = map_ID.user_to_id(car.Owners[1]);
+        let approvalNumber = 'DEMO/' + manufacturer + '/' + car.Make + '/' + car.Model;
+        if (approved[approvalNumber]) {
+            return;
+        }
+        approved[approvalNumber] = true;
+        result = result.then(function() {
+            console.log('[#] Approving ' + car.Make + ' ' + car.Model + ' for ' + manufacturer);
+            let args = [ manufacturer, car.Make, car.Model, approvalNumber ];
+            return Util.invokeChaincode(regulatorSecurityContext, 'approve_type', args)
+            .catch(function(err) {
+                if (JSON.stringify(err).indexOf('already') === -1) {
+                    throw err;
+                }
+            });
+        });
+    });
+    return result;
+}
+
 function createVehicles(cars) {
     return cars.reduce(function(prev, car, index) {
         return prev.then(function() {
@@ -149,9 +213,14 @@ function populateVehicleProperty(v5cID, ownerId, propertyName, propertyValue) {
     return vehicleData.updateAttribute(ownerId, 'update_'+normalisedPropertyName, propertyValue, v5cID);
 }
 
+// The manufacturer gives the vehicle a VIN under its first WMI before the other properties are set
 function populateVehicle(v5cID, car) {
     console.log('[#] Populating Vehicle');
-    let result = Promise.resolve();
+    let manufacturer = participants.manufacturers.find(function(details) {
+        return details.name === car.Owners[1];
+    });
+    let vin = Vehicle.newVIN(manufacturer.wmis[0]);
+    let result = populateVehicleProperty(v5cID, map_ID.user_to_id(car.Owners[1]), 'VIN', vin);
     for(let propertyName in car) {
         let normalisedPropertyName = propertyName.toLowerCase();
         let propertyValue = car[propertyName];
@@ -164,9 +233,13 @@ function populateVehicle(v5cID, car) {
     return result;
 }
 
+// Offers the vehicle to the buyer and accepts the offer as the buyer
 function transferVehicle(v5cID, seller, buyer, functionName) {
     console.log('[#] Transfering Vehicle to ' + buyer);
-    return vehicleData.transfer(seller, buyer, functionName, v5cID);
+    return vehicleData.transfer(seller, buyer, functionName, v5cID)
+    .then(function() {
+        return vehicleData.acceptTransfer(buyer, v5cID);
+    });
 }
 
 function updateDemoStatus(status) {
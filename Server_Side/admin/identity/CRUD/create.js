@@ -9,14 +9,24 @@ let tracing = require(__dirname+'/../../../tools/traces/trace.js');
 
 function makeAccount(req, res, usersToSecurityContext) //Checks to see if user details passed are valid. If so, log them in and start a session.
 {
-    let userID = map_ID.user_to_id(req.body.account);
-    let securityContext = usersToSecurityContext[userID];
-
     tracing.create('ENTER', 'POST admin/identity', req.body);
 
+    return map_ID.ready(usersToSecurityContext)
+    .then(function() {
+        logIn(req, res, usersToSecurityContext[map_ID.user_to_id(req.body.account)]);
+    })
+    .catch(function(err) {
+        res.status(400);
+        tracing.create('ERROR', 'POST admin/identity', err);
+        res.send({'message':'Unable to log user in', 'error': true});
+    });
+}
+
+function logIn(req, res, securityContext)
+{
     tracing.create('INFO', 'POST admin/identity', 'Calling /registrar endpoint');
 
-    if (securityContext.getEnrolledMember) {
+    if (securityContext && securityContext.getEnrolledMember) {
         let user = securityContext.getEnrolledMember();
         req.session.user = map_ID.id_to_user(user.getName());
         req.session.identity = user.getName();
@@ -0,0 +1,39 @@
+'use strict';
+
+let tracing = require(__dirname+'/../../../../tools/traces/trace.js');
+let map_ID = require(__dirname+'/../../../../tools/map_ID/map_ID.js');
+let Vehicle = require(__dirname+'/../../../../tools/utils/vehicle');
+
+// Reads the transfer offers waiting for the user to accept or reject them
+let read = function(req, res, next, usersToSecurityContext)
+{
+    let vehicleData = new Vehicle(usersToSecurityContext);
+
+    tracing.create('ENTER', 'GET blockchain/assets/offers', {});
+
+    if(typeof req.cookies.user !== 'undefined')
+    {
+        req.session.user = req.cookies.user;
+        req.session.identity = map_ID.user_to_id(req.cookies.user);
+    }
+
+    return vehicleData.pendingOffers(req.session.identity)
+    .then(function(data) {
+        let offers = JSON.parse(data.toString());
+        offers.forEach(function(offer) {
+            offer.from = map_ID.id_to_user(offer.from);
+        });
+        tracing.create('EXIT', 'GET blockchain/assets/offers', {'offers':offers});
+        res.send({'offers':offers});
+    })
+    .catch(function(err) {
+        res.status(400);
+        let error = {};
+        error.message = 'Unable to retrieve offers';
+        error.error = true;
+        tracing.create('ERROR', 'GET blockchain/assets/offers', err);
+        res.send(error);
+    });
+};
+
+exports.read = read;
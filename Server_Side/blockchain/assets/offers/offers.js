@@ -0,0 +1,2 @@
+var read = require(__dirname+'/CRUD/read.js');
+exports.read = read.read;
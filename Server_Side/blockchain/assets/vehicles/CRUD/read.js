@@ -22,10 +22,29 @@ function get_all_cars(req, res, next, usersToSecurityContext)
     user_id = req.session.identity;
     securityContext = usersToSecurityContext[user_id];
 
-    return Util.queryChaincode(securityContext, 'get_vehicles', [])
+    let filter = {};
+    ['owner', 'keeper', 'make', 'model', 'colour', 'leaseContractID'].forEach(function(field) {
+        if (typeof req.query[field] !== 'undefined') {
+            filter[field] = req.query[field];
+        }
+    });
+    if (typeof req.query.status !== 'undefined') {
+        filter.status = parseInt(req.query.status);
+    }
+    if (typeof req.query.scrapped !== 'undefined') {
+        filter.scrapped = req.query.scrapped === 'true';
+    }
+
+    let args = [JSON.stringify(filter), req.query.pageSize || '', req.query.next || '', req.query.count === 'true' ? 'true' : ''];
+
+    return Util.queryChaincode(securityContext, 'get_vehicles', args)
     .then(function(data) {
-        let cars = JSON.parse(data.toString());
-        console.log(cars);
+        let page = JSON.parse(data.toString());
+        let cars = page.vehicles;
+        res.setHeader('X-Next-Page', page.next);
+        if (typeof page.total !== 'undefined') {
+            res.setHeader('X-Total-Count', page.total);
+        }
         cars.forEach(function(car) {
             tracing.create('INFO', 'GET blockchain/assets/vehicles', JSON.stringify(car));
             res.write(JSON.stringify(car)+'&&');
@@ -2,7 +2,6 @@
 let simple_scenario = {
     'cars': [
         {
-            'VIN': '287437467447767',
             'Make': 'Toyota',
             'Model': 'Auris',
             'Colour': 'Blue',
@@ -10,7 +9,6 @@ let simple_scenario = {
             'Owners': ['DVLA', 'Toyota', 'Beechvale Group', 'LeaseCan']
         },
         {
-            'VIN': '549523556856725',
             'Make': 'Jaguar',
             'Model': 'F-Type',
             'Colour': 'Red',
@@ -18,7 +16,6 @@ let simple_scenario = {
             'Owners': ['DVLA', 'Jaguar Land Rover', 'Beechvale Group']
         },
         {
-            'VIN': '880352730316924',
             'Make': 'Alfa Romeo',
             'Model': 'MiTo',
             'Colour': 'Blue',
@@ -31,7 +28,6 @@ let simple_scenario = {
 let full_scenario = {
     'cars': [
         {
-            'VIN': '720965981630055',
             'Make': 'Toyota',
             'Model': 'Yaris',
             'Colour': 'Red',
@@ -39,7 +35,6 @@ let full_scenario = {
             'Owners': ['DVLA', 'Toyota', 'Beechvale Group', 'LeaseCan', 'Joe Payne', 'Cray Bros (London) Ltd']
         },
         {
-            'VIN': '287437467447767',
             'Make': 'Toyota',
             'Model': 'Auris',
             'Colour': 'Blue',
@@ -47,7 +42,6 @@ let full_scenario = {
             'Owners': ['DVLA', 'Toyota', 'Beechvale Group', 'LeaseCan']
         },
         {
-            'VIN': '948881310167423',
             'Make': 'Toyota',
             'Model': 'Celica',
             'Colour': 'Silver',
@@ -55,7 +49,6 @@ let full_scenario = {
             'Owners': ['DVLA', 'Toyota', 'Beechvale Group']
         },
         {
-            'VIN': '181255391772389',
             'Make': 'Jaguar',
             'Model': 'XJ',
             'Colour': 'Black',
@@ -63,7 +56,6 @@ let full_scenario = {
             'Owners': ['DVLA', 'Jaguar Land Rover', 'Beechvale Group', 'LeaseCan']
         },
         {
-            'VIN': '549523556856725',
             'Make': 'Jaguar',
             'Model': 'F-Type',
             'Colour': 'Red',
@@ -71,7 +63,6 @@ let full_scenario = {
             'Owners': ['DVLA', 'Jaguar Land Rover', 'Beechvale Group']
         },
         {
-            'VIN': '523447019546831',
             'Make': 'Land Rover',
             'Model': 'Defender',
             'Colour': 'Silver',
@@ -79,7 +70,6 @@ let full_scenario = {
             'Owners': ['DVLA', 'Jaguar Land Rover', 'Beechvale Group']
         },
         {
-            'VIN': '546303780997253',
             'Make': 'Alfa Romeo',
             'Model': 'Giulietta',
             'Colour': 'White',
@@ -87,7 +77,6 @@ let full_scenario = {
             'Owners': ['DVLA', 'Alfa Romeo']
         },
         {
-            'VIN': '128994473011261',
             'Make': 'Alfa Romeo',
             'Model': 'MiTO',
             'Colour': 'Black',
@@ -95,7 +84,6 @@ let full_scenario = {
             'Owners': ['DVLA', 'Alfa Romeo']
         },
         {
-            'VIN': '747542562791231',
             'Make': 'Alfa Romeo',
             'Model': '4C',
             'Colour': 'Red',
@@ -103,7 +91,6 @@ let full_scenario = {
             'Owners': ['DVLA', 'Alfa Romeo']
         },
         {
-            'VIN': '880352730316924',
             'Make': 'Alfa Romeo',
             'Model': 'MiTo',
             'Colour': 'Blue',
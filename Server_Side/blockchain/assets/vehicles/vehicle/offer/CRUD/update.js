@@ -0,0 +1,42 @@
+'use strict';
+
+let tracing = require(__dirname+'/../../../../../../tools/traces/trace.js');
+let map_ID = require(__dirname+'/../../../../../../tools/map_ID/map_ID.js');
+let Vehicle = require(__dirname+'/../../../../../../tools/utils/vehicle');
+
+// Accepts the pending offer of the vehicle to the user, or rejects it when accept is false
+let update = function(req, res, next, usersToSecurityContext)
+{
+    let vehicleData = new Vehicle(usersToSecurityContext);
+    let v5cID = req.params.v5cID;
+    let accept = req.body.accept !== false;
+
+    if(typeof req.cookies.user !== 'undefined')
+    {
+        req.session.user = req.cookies.user;
+        req.session.identity = map_ID.user_to_id(req.cookies.user);
+    }
+    let user_id = req.session.identity;
+
+    tracing.create('ENTER', 'PUT blockchain/assets/vehicles/'+v5cID+'/offer', req.body);
+
+    let result = accept ? vehicleData.acceptTransfer(user_id, v5cID) : vehicleData.rejectTransfer(user_id, v5cID);
+
+    return result
+    .then(function(data) {
+        let message = {};
+        message.message = accept ? 'Transfer accepted' : 'Transfer rejected';
+        tracing.create('EXIT', 'PUT blockchain/assets/vehicles/'+v5cID+'/offer', data);
+        res.send(message);
+    })
+    .catch(function(err) {
+        res.status(400);
+        let error = {};
+        error.error = true;
+        error.message = err;
+        tracing.create('ERROR', 'PUT blockchain/assets/vehicles/'+v5cID+'/offer', err);
+        res.send(error);
+    });
+};
+
+exports.update = update;
@@ -0,0 +1,2 @@
+var update = require(__dirname+'/CRUD/update.js');
+exports.update = update.update;
@@ -38,7 +38,7 @@ let update = function(req, res, next, usersToSecurityContext, property)
         tracing.create('INFO', 'PUT blockchain/assets/vehicles/'+v5cID+'/' + property, 'Achieving Consensus');
         res.write('{"message":"Achieving Consensus"}&&');
         let result = {};
-        result.message = property + ' updated';
+        result.message = (property === 'owner') ? 'Transfer offered, waiting for the recipient to accept' : property + ' updated';
         tracing.create('EXIT', 'PUT blockchain/assets/vehicles/'+v5cID+'/' + property, data);
         res.end(JSON.stringify(result));
     })
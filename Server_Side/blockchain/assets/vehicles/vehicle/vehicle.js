@@ -46,3 +46,8 @@ var owner = {};
 owner.update = ownerFile.update;
 owner.read = ownerFile.read;
 exports.owner = owner;
+
+var offerFile = require(__dirname+'/offer/offer.js');
+var offer = {};
+offer.update = offerFile.update;
+exports.offer = offer;
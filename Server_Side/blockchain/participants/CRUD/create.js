@@ -3,12 +3,13 @@
 let request = require('request');
 let fs = require('fs');
 let tracing = require(__dirname+'/../../../tools/traces/trace.js');
-let configFile = require(__dirname+'/../../../configurations/configuration.js'),
-    participants = require(__dirname+'/../participants_info.js');
+let configFile = require(__dirname+'/../../../configurations/configuration.js');
+let map_ID = require(__dirname+'/../../../tools/map_ID/map_ID.js');
+let Participant = require(__dirname+'/../../../tools/utils/participant.js');
 
 let counter = 0;
 
-let registerUser = function(req, res) {
+let registerUser = function(req, res, next, usersToSecurityContext) {
 
     tracing.create('ENTER', 'POST blockchain/participants', req.body);
 
@@ -39,10 +40,10 @@ let registerUser = function(req, res) {
 
     //TEMPORARY, REMOVE WHEN USING NODE SDK
     let secret = '';
-    loginUser(req, res,secret);
+    loginUser(req, res, usersToSecurityContext, secret);
 };
 
-function loginUser(req, res, secret)
+function loginUser(req, res, usersToSecurityContext, secret)
 {
     let credentials = {
         'enrollId': req.body.company,
@@ -61,7 +62,7 @@ function loginUser(req, res, secret)
         {
             counter = 0;
             tracing.create('INFO', 'POST blockchain/participants', 'Login successful');
-            writeUserToFile(req, res, secret);
+            addUserToRegistry(req, res, usersToSecurityContext, secret);
         }
         else
         {
@@ -77,88 +78,73 @@ function loginUser(req, res, secret)
             else{
                 counter++;
                 tracing.create('INFO', 'POST blockchain/participants', 'Trying to log in again');
-                setTimeout(function(){loginUser(req, res, secret);},2000);
+                setTimeout(function(){loginUser(req, res, usersToSecurityContext, secret);},2000);
             }
 
         }
     });
 }
 
-function writeUserToFile(req, res, secret)
+function addUserToRegistry(req, res, usersToSecurityContext, secret)
 {
-
     let userType = '';
-    let userNumber = '';
-
-    for(let k in participants)
+    switch(req.body.affiliation)
     {
-        if (participants.hasOwnProperty(k))
-        {
-
-            let data = participants[k];
-            for(let i = 0; i < data.length; i++)
-           {
-
-                if(data[i].identity == req.body.company)
-                   {
-                    userType = k;
-                    userNumber = i;
-                    break;
-                }
-            }
-        }
+    case 'Regulator':
+        userType='regulators';
+        break;
+    case 'Manufacturer':
+        userType='manufacturers';
+        break;
+    case 'Dealership':
+        userType='dealerships';
+        break;
+    case 'Lease Company':
+        userType='lease_companies';
+        break;
+    case 'Leasee':
+        userType='leasees';
+        break;
+    case 'Scrap Merchant':
+        userType='scrap_merchants';
+        break;
     }
 
-    let newData = participants;
-    if(userType == '')
-    {
-        switch(req.body.affiliation)
-        {
-        case 'Regulator':
-            userType='regulators';
-            break;
-        case 'Manufacturer':
-            userType='manufacturers';
-            break;
-        case 'Dealership':
-            userType='dealerships';
-            break;
-        case 'Lease Company':
-            userType='lease_companies';
-            break;
-        case 'Leasee':
-            userType='leasees';
-            break;
-        case 'Scrap Merchant':
-            userType='scrap_merchants';
-            break;
-        }
-        userNumber = newData[userType].length;
-        newData[userType].push({});
-        newData[userType][userNumber].name = add_slashes(req.body.company);
-        newData[userType][userNumber].identity = add_slashes(req.body.company);
-        newData[userType][userNumber].address_line_1 = add_slashes(req.body.street_name);
-        newData[userType][userNumber].address_line_2 = add_slashes(req.body.city);
-        newData[userType][userNumber].postcode = req.body.postcode;
-
-        let configData = 'config.participants.users.'+userType+'['+userNumber+'] = {}\n';
-        configData += 'config.participants.users.'+userType+'['+userNumber+'].company = \''+escape_quote(add_slashes(req.body.company))+'\'\n';
-        configData += 'config.participants.users.'+userType+'['+userNumber+'].type = \''+req.body.affiliation+'\'\n';
-        configData += 'config.participants.users.'+userType+'['+userNumber+'].user = \''+escape_quote(add_slashes(req.body.username))+'\'\n';
-        fs.appendFileSync(__dirname+'/../../../../Client_Side/JavaScript/config/config.js', configData);
+    let details = {
+        'name': req.body.company,
+        'identity': req.body.username,
+        'address_line_1': req.body.street_name,
+        'address_line_2': req.body.city,
+        'postcode': req.body.postcode
+    };
 
-    }
-    newData[userType][userNumber].password = secret;
+    // Only the regulator can add participants to the registry on the ledger
+    let participant = new Participant(usersToSecurityContext);
+    return participant.register(map_ID.user_to_id('DVLA'), userType, details)
+    .then(function() {
+        map_ID.load([details]);
 
-    let updatedFile = '/*eslint-env node*/\n\nvar user_info = JSON.parse(process.env.VCAP_SERVICES)["ibm-blockchain-5-prod"][0]["credentials"]["users"];\n\nvar participants_info = '+JSON.stringify(newData)+'\n\nexports = participants_info;';
+        let configData = 'config.participants.users.'+userType+'.push({});\n';
+        configData += 'config.participants.users.'+userType+'[config.participants.users.'+userType+'.length-1].company = \''+escape_quote(add_slashes(req.body.company))+'\'\n';
+        configData += 'config.participants.users.'+userType+'[config.participants.users.'+userType+'.length-1].type = \''+req.body.affiliation+'\'\n';
+        configData += 'config.participants.users.'+userType+'[config.participants.users.'+userType+'.length-1].user = \''+escape_quote(add_slashes(req.body.username))+'\'\n';
+        fs.appendFileSync(__dirname+'/../../../../Client_Side/JavaScript/config/config.js', configData);
 
-    fs.writeFileSync(__dirname+'/../participants_info.js', updatedFile);
-    let result = {};
-    result.message = 'User creation successful';
-    result.id = req.body.company;
-    result.secret = secret;
-    tracing.create('EXIT', 'POST blockchain/participants', result);
-    res.send(result);
+        let result = {};
+        result.message = 'User creation successful';
+        result.id = req.body.company;
+        result.secret = secret;
+        tracing.create('EXIT', 'POST blockchain/participants', result);
+        res.send(result);
+    })
+    .catch(function(err) {
+        res.status(400);
+        let error = {};
+        error.message = 'Unable to add user to the participant registry';
+        error.error = true;
+        tracing.create('ERROR', 'POST blockchain/participants', err);
+        res.send(error);
+    });
 }
 
 exports.create = registerUser;
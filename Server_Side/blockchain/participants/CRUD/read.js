@@ -1,24 +1,75 @@
 'use strict';
 
 let tracing = require(__dirname+'/../../../tools/traces/trace.js');
-let participants = require(__dirname+'/../participants_info.js');
+let map_ID = require(__dirname+'/../../../tools/map_ID/map_ID.js');
+let Util = require(__dirname+'/../../../tools/utils/util.js');
+let Participant = require(__dirname+'/../../../tools/utils/participant.js');
 
-let read = function(req, res)
+// The participant type stored in the chaincode's participant registry for each group of participants
+let types = Participant.TYPES;
+
+// Converts a participant from the registry into the format the client expects
+function format_participant(participant)
+{
+    let formatted = {
+        'name': participant.name,
+        'identity': participant.identity,
+        'postcode': participant.postcode
+    };
+    (participant.address || []).forEach(function(line, i) {
+        formatted['address_line_'+(i+1)] = line;
+    });
+    return formatted;
+}
+
+// Reads the participants of one group (or every group when group is undefined) from the participant registry
+function read_participants(req, res, usersToSecurityContext, group)
 {
-    tracing.create('ENTER', 'GET blockchain/participants/', {});
-    if(participants == null)
-	{
+    let path = 'GET blockchain/participants/' + (group || '');
+    tracing.create('ENTER', path, {});
+
+    if(typeof req.cookies.user !== 'undefined')
+    {
+        req.session.user = req.cookies.user;
+        req.session.identity = map_ID.user_to_id(req.cookies.user);
+    }
+    let securityContext = usersToSecurityContext[req.session.identity];
+
+    return Util.queryChaincode(securityContext, 'get_participants', ['', group ? types[group] : ''])
+    .then(function(data) {
+        let registry = JSON.parse(data.toString());
+        map_ID.load(registry);
+        let participants = {};
+        for(let name in types)
+        {
+            participants[name] = [];
+        }
+        registry.forEach(function(participant) {
+            for(let name in types)
+            {
+                if(types[name] === participant.type)
+                {
+                    participants[name].push(format_participant(participant));
+                }
+            }
+        });
+        let result = group ? participants[group] : participants;
+        tracing.create('EXIT', path, {'result':result});
+        res.send({'result':result});
+    })
+    .catch(function(err) {
         res.status(404);
         let error = {};
         error.message = 'Unable to retrieve participants';
         error.error = true;
-        tracing.create('ERROR', 'GET blockchain/participants/', error);
+        tracing.create('ERROR', path, err);
         res.send(error);
-    }
-    else
-	{
-        tracing.create('EXIT', 'GET blockchain/participants/', {'result':participants});
-        res.send({'result':participants});
-    }
+    });
+}
+
+let read = function(req, res, next, usersToSecurityContext)
+{
+    return read_participants(req, res, usersToSecurityContext);
 };
 exports.read = read;
+exports.read_participants = read_participants;
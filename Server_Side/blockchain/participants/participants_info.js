@@ -21,7 +21,8 @@ let participants_info = {
             'address_line_1': '25 St James\'s Street',
             'address_line_2': 'London',
             'address_line_3': 'United Kingdom',
-            'postcode': 'SW1A 1HA'
+            'postcode': 'SW1A 1HA',
+            'wmis': ['ZAR']
         },
         {
             'name': 'Toyota',
@@ -30,7 +31,8 @@ let participants_info = {
             'address_line_1': 'Burnaston',
             'address_line_2': 'Derby',
             'address_line_3': 'United Kingdom',
-            'postcode': 'DE1 9TA'
+            'postcode': 'DE1 9TA',
+            'wmis': ['SB1']
         },
         {
             'name': 'Jaguar Land Rover',
@@ -39,7 +41,8 @@ let participants_info = {
             'address_line_1': 'Abbey Road',
             'address_line_2': 'Coventry',
             'address_line_3': 'United Kingdom',
-            'postcode': 'CV3 4LF'
+            'postcode': 'CV3 4LF',
+            'wmis': ['SAJ', 'SAL']
         }
     ],
     'dealerships': [
@@ -1,49 +1,64 @@
 'use strict';
 
-let participants = require(__dirname+'/../../blockchain/participants/participants_info.js');
+let Util = require(__dirname+'/../utils/util.js');
 
+// Names and identities of the participants read from the participant registry on the ledger, see load and ready
+let names = {};
+let identities = {};
+let loaded;
 
-let id_to_user = function(data)
+let load = function(participants)
 {
-    for(let role in participants)
+    for(let i = 0; i < participants.length; i++)
     {
-        for(let j = 0; j < participants[role].length; j++)
-        {
-            if(participants[role][j].identity === data)
-            {
-                return participants[role][j].name;
-            }
-        }
+        names[participants[i].identity] = participants[i].name;
+        identities[participants[i].name] = participants[i].identity;
     }
 };
 
-let user_to_id = function(data)
+// Reads the participant registry into the cache once, using any enrolled user to query it. Returns a promise that
+// resolves once the cache is loaded so names can be resolved with user_to_id.
+let ready = function(usersToSecurityContext)
 {
-    for(let role in participants)
+    if(typeof loaded === 'undefined')
     {
-        for(let j = 0; j < participants[role].length; j++)
-        {
-            if(participants[role][j].name === data)
-            {
-                return participants[role][j].identity;
-            }
-        }
+        let users = Object.keys(usersToSecurityContext);
+        loaded = Util.queryChaincode(usersToSecurityContext[users[0]], 'get_participants', [])
+        .then(function(data) {
+            load(JSON.parse(data.toString()));
+        })
+        .catch(function(err) {
+            loaded = undefined;
+            throw err;
+        });
     }
+    return loaded;
 };
 
-let get_password = function(partType, data)
+let id_to_user = function(data)
 {
-    for(let i = 0; i < participants[partType].length; i++)
+    if(names.hasOwnProperty(data))
     {
-        if(participants[partType][i].name === data || participants[partType][i].identity === data)
-        {
-            return participants[partType][i].password;
-        }
+        return names[data];
     }
+    return data;
 };
 
+// Throws when the name isn't in the cache, the registry has to be loaded before names can be resolved
+let user_to_id = function(data)
+{
+    if(typeof data === 'undefined')
+    {
+        return data;
+    }
+    if(identities.hasOwnProperty(data))
+    {
+        return identities[data];
+    }
+    throw new Error('Unknown participant ' + data + ', the participant registry has not been loaded');
+};
 
-
+exports.load = load;
+exports.ready = ready;
 exports.id_to_user = id_to_user;
 exports.user_to_id = user_to_id;
-exports.get_password = get_password;
@@ -0,0 +1,65 @@
+'use strict';
+
+const Util = require('./util.js');
+
+// The role and type stored in the chaincode's participant registry for each group of participants. Dealerships and
+// leasees are private participants, their type tells them apart.
+const ROLES = {
+    'regulators': 'regulator',
+    'manufacturers': 'manufacturer',
+    'dealerships': 'private',
+    'lease_companies': 'lease_company',
+    'leasees': 'private',
+    'scrap_merchants': 'scrap_merchant'
+};
+
+const TYPES = {
+    'regulators': 'regulator',
+    'manufacturers': 'manufacturer',
+    'dealerships': 'dealership',
+    'lease_companies': 'lease_company',
+    'leasees': 'leasee',
+    'scrap_merchants': 'scrap_merchant'
+};
+
+class Participant {
+
+    constructor(usersToSecurityContext) {
+        this.usersToSecurityContext = usersToSecurityContext;
+    }
+
+    // Adds a participant of the group to the registry. Only the regulator can register participants so userId must be
+    // a regulator. details holds the name, identity, address_line_1 to address_line_4, postcode and, for
+    // manufacturers, the wmis assigned to them.
+    register(userId, group, details) {
+        let securityContext = this.usersToSecurityContext[userId];
+        let participant = Participant.toRegistry(group, details);
+
+        return Util.invokeChaincode(securityContext, 'register_participant', [ JSON.stringify(participant) ]);
+    }
+
+    static toRegistry(group, details) {
+        let participant = {
+            'identity': details.identity,
+            'role': ROLES[group],
+            'type': TYPES[group],
+            'name': details.name,
+            'address': [],
+            'postcode': details.postcode
+        };
+        for(let i = 1; i <= 4; i++) {
+            if (typeof details['address_line_'+i] !== 'undefined') {
+                participant.address.push(details['address_line_'+i]);
+            }
+        }
+        if (details.wmis) {
+            participant.wmis = details.wmis;
+        }
+        return participant;
+    }
+}
+
+Participant.ROLES = ROLES;
+Participant.TYPES = TYPES;
+
+module.exports = Participant;
@@ -23,10 +23,27 @@ class Vehicle {
         });
     }
 
+    // Offers the vehicle to the buyer with the lifecycle transfer functionName. The vehicle only moves once the buyer
+    // accepts the offer with acceptTransfer.
     transfer(userId, buyer, functionName, v5cID) {
         return this.updateAttribute(userId, functionName , buyer, v5cID);
     }
 
+    acceptTransfer(userId, v5cID) {
+        let securityContext = this.usersToSecurityContext[userId];
+        return Util.invokeChaincode(securityContext, 'accept_transfer', [ v5cID ]);
+    }
+
+    rejectTransfer(userId, v5cID) {
+        let securityContext = this.usersToSecurityContext[userId];
+        return Util.invokeChaincode(securityContext, 'reject_transfer', [ v5cID ]);
+    }
+
+    pendingOffers(userId) {
+        let securityContext = this.usersToSecurityContext[userId];
+        return Util.queryChaincode(securityContext, 'get_pending_offers', []);
+    }
+
     updateAttribute(userId, functionName, value, v5cID) {
         let securityContext = this.usersToSecurityContext[userId];
         return Util.invokeChaincode(securityContext, functionName, [ value, v5cID ]);
@@ -49,6 +66,25 @@ class Vehicle {
         v5cID = characters.charAt(Math.floor(Math.random() * characters.length)) + v5cID;
         return v5cID;
     }
+
+    // Makes up an ISO 3779 VIN for a vehicle built by the manufacturer with the WMI. The 9th character is the check
+    // digit worked out from the other 16, the chaincode rejects VINs where it doesn't match.
+    static newVIN(wmi) {
+        let characters = 'ABCDEFGHJKLMNPRSTUVWXYZ1234567890';
+        let values = '12345678123457923456789';
+        let weights = [8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2];
+        let vin = wmi;
+        for(let i = vin.length; i < 17; i++) {
+            vin += characters.charAt(Math.floor(Math.random() * characters.length));
+        }
+        let sum = 0;
+        for(let i = 0; i < 17; i++) {
+            let index = characters.indexOf(vin.charAt(i));
+            let value = index < values.length ? parseInt(values.charAt(index)) : parseInt(vin.charAt(i));
+            sum += value * weights[i];
+        }
+        return vin.substring(0, 8) + '0123456789X'.charAt(sum % 11) + vin.substring(9);
+    }
 }
 
 module.exports = Vehicle;